@@ -4,6 +4,7 @@ import (
 	"github.com/olivere/elastic"
 	"sync"
 	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/connection"
 )
 
 type Manager struct {
@@ -12,11 +13,29 @@ type Manager struct {
 }
 
 type ManagerConfig struct {
+	// Loaded connection settings, applied before ElasticConfigs
+	Connection *connection.Config
 	ElasticConfigs []elastic.ClientOptionFunc
 }
 
 func NewManager(config *ManagerConfig) (manager *Manager, err error) {
-	client, err := elastic.NewClient(config.ElasticConfigs...)
+	options := config.ElasticConfigs
+
+	if config.Connection != nil {
+		httpClient, err := config.Connection.HTTPClient()
+		if err != nil {
+			return nil, err
+		}
+
+		options = append([]elastic.ClientOptionFunc{
+			elastic.SetURL(config.Connection.URL),
+			elastic.SetSniff(false),
+			elastic.SetHttpClient(httpClient),
+			elastic.SetGzip(config.Connection.Gzip),
+		}, options...)
+	}
+
+	client, err := elastic.NewClient(options...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error creating new elastic client")
 	}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"github.com/spf13/pflag"
 	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/connection"
 	"time"
 	"net"
 	"os"
@@ -12,7 +13,7 @@ import (
 )
 
 type Flags struct {
-	Server string
+	Connection connection.Config
 	Owners []string
 	Dir string
 	Exec string
@@ -54,7 +55,7 @@ func Parse() (flags *Flags, err error) {
 		Host: fmt.Sprintf("%s:%s", outbound, listenURL.Port()),
 	}
 
-	pflag.StringVar(&flags.Server, "server", "http://localhost:9200", "Specify elasticsearch server to query")
+	flags.Connection.AddFlags(pflag.CommandLine)
 	pflag.StringVar(&flags.Index, "index", "", "Specify the elasticsearch index to query")
 	pflag.StringVar(&flags.Dir, "dir", "", "Directory where the .json files are")
 	pflag.StringVar(&flags.Exec, "exec", "", "Execute a command when alerting")
@@ -64,6 +65,9 @@ func Parse() (flags *Flags, err error) {
 	pflag.DurationVar(&flags.QueryDelay, "query-delay", time.Second, "When using \"now\", delay the query to allow index time")
 
 	pflag.Parse()
+	pflag.Visit(func(f *pflag.Flag) {
+		flags.Connection.SetFlag(f.Name)
+	})
 
 	if flags.Index == "" {
 		return nil, errors.Wrap(ErrFlagRequired, "index")
@@ -89,6 +93,13 @@ func Parse() (flags *Flags, err error) {
 		return nil, errors.Wrapf(err, "Fail to assert flag %q", "dir")
 	}
 
+	conn, err := connection.Load(flags.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	flags.Connection = *conn
+
 	return flags, nil
 }
 
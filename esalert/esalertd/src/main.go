@@ -10,7 +10,6 @@ import (
 	"./flags"
 	"./util"
 	"./response"
-	"github.com/olivere/elastic"
 )
 
 func main() {
@@ -31,10 +30,7 @@ func main() {
 	}
 
 	cm, err := client.NewManager(&client.ManagerConfig{
-		ElasticConfigs: []elastic.ClientOptionFunc{
-			elastic.SetSniff(false),
-			elastic.SetURL(f.Server),
-		},
+		Connection: &f.Connection,
 	})
 	if err != nil {
 		util.Fatal(err)
@@ -3,33 +3,11 @@ package util
 import (
 	"bytes"
 	"text/template"
-	"encoding/json"
+	"github.com/tehmoon/estools/lib/templates"
 )
 
-var templateFuncs = template.FuncMap{
-	"newline": func() (string) {
-		return "\n"
-	},
-	"json": func(d interface{}) (string) {
-		payload, err := json.Marshal(d)
-		if err != nil {
-			return ""
-		}
-
-		return string(payload[:])
-	},
-	"json_indent": func(d interface{}) (string) {
-		payload, err := json.MarshalIndent(d, "", "  ")
-		if err != nil {
-			return ""
-		}
-
-		return string(payload[:])
-	},
-}
-
 func NewTemplate() (tmpl *template.Template) {
-	return template.New("root").Funcs(templateFuncs)
+	return templates.New()
 }
 
 func TemplateToBytes(tmpl *template.Template, v interface{}) (text []byte, err error) {
@@ -5,16 +5,20 @@ import (
 	"fmt"
 	"os"
 	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/connection"
+	"github.com/tehmoon/estools/lib/flags"
 )
 
 var (
-	ErrFlagsMissing error
+	ErrFlagsMissing error = errors.New("Flag is missing")
 	ErrFlagsModuleMissing error = errors.New("Module is missing")
 	ErrFlagsCommandMissing error = errors.New("Command is missing")
 )
 
 type Flags struct {
 	ConfigFile string
+	ConfigFiles flags.Strings
+	Profile string
 	Command string
 	Module string
 	Rest []string
@@ -27,14 +31,32 @@ func init() {
 func parseFlags() (*Flags, error) {
 	flags := &Flags{}
 
-	flag.StringVar(&flags.ConfigFile, "c", "", "Config file to use")
+	flag.Var(&flags.ConfigFiles, "c", "Config file to use, can be repeated to layer files. Changes are written to the last one")
+
+	flag.StringVar(&flags.Profile, "profile", "", "Named cluster of ~/.estools. Its config is used without -c, pull and push use its connection")
 
 	flag.Parse()
 
-	if flags.ConfigFile == "" {
+	if len(flags.ConfigFiles) == 0 && flags.Profile == "" {
 		return nil, errors.Wrapf(ErrFlagsMissing, "Flag -c is missing")
 	}
 
+	// The filter set of the profile, only when it is named
+	if len(flags.ConfigFiles) == 0 {
+		profile, err := connection.ReadProfile(flags.Profile)
+		if err != nil {
+			return nil, err
+		}
+
+		if profile.Config == "" {
+			return nil, errors.Wrapf(ErrFlagsMissing, "Flag -c is missing and profile %s has no config", flags.Profile)
+		}
+
+		flags.ConfigFiles = []string{profile.Config,}
+	}
+
+	flags.ConfigFile = flags.ConfigFiles[len(flags.ConfigFiles) - 1]
+
 	args := flag.Args()
 	switch len(args){
 		case 0:
@@ -58,14 +80,14 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "")
 
 	fmt.Fprintf(os.Stderr, "Command:\n")
-	for _, command := range []string{"resolve", "add", "delete", "list"} {
+	for _, command := range []string{"resolve", "add", "update", "rename", "delete", "list", "show", "lint", "graph", "export", "import", "pull", "push", "serve"} {
 		fmt.Fprintf(os.Stderr, "  %s\n", command)
 	}
 
 	fmt.Fprintln(os.Stderr, "")
 
 	fmt.Fprintf(os.Stderr, "Module:\n")
-	for _, module := range []string{"filter"} {
+	for _, module := range []string{"filter", "aggregation", "json", "placeholder", "config"} {
 		fmt.Fprintf(os.Stderr, "  %s\n", module)
 	}
 }
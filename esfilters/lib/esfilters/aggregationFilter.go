@@ -0,0 +1,93 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"strings"
+)
+
+type AggregationFilter struct {
+	Name string
+	Aggregation string
+	Placeholders map[string]string
+	Builtin bool
+}
+
+var (
+	ErrAggregationFilterValueNotFound error = errors.New("aggregation not found")
+	ErrAggregationFilterInvalidJSON error = errors.New("aggregation is not valid JSON")
+)
+
+// Built-in aggregations, they can be overridden by declaring
+// an aggregation with the same name.
+// An empty placeholder means that the value is required.
+var builtinAggregationFilters = map[string]*AggregationFilter{
+	"count": &AggregationFilter{
+		Name: "count",
+		Aggregation: `{"value_count":{"field":"%{placeholder:field}"}}`,
+		Placeholders: map[string]string{
+			"field": "@timestamp",
+		},
+	},
+	"field_uniq_per_terms": &AggregationFilter{
+		Name: "field_uniq_per_terms",
+		Aggregation: `{"terms":{"field":"%{placeholder:field1}"},"aggregations":{"1":{"cardinality":{"field":"%{placeholder:field2}"}}}}`,
+		Placeholders: map[string]string{
+			"field1": "",
+			"field2": "",
+		},
+	},
+}
+
+func parseAggregation(a *AggregationFilter) (error) {
+	if ok := QueryRegexpName.MatchString(a.Name); ! ok {
+		return errors.Errorf("Invalid name %s", a.Name)
+	}
+
+	for name := range a.Placeholders {
+		if ok := QueryRegexpName.MatchString(name); ! ok {
+			return errors.Errorf("Invalid placeholder name %s", name)
+		}
+	}
+
+	// Placeholders are either inside a JSON string or used as a number,
+	// 0 keeps the document valid in both cases.
+	body := QueryRegexp.ReplaceAllStringFunc(a.Aggregation, func(str string) (string) {
+		part := QueryRegexp.FindStringSubmatch(str)
+		if strings.HasPrefix(part[1], "placeholder:") {
+			return "0"
+		}
+
+		return str
+	})
+
+	return validateAggregation(body)
+}
+
+func validateAggregation(body string) (error) {
+	if ok := json.Valid([]byte(body)); ! ok {
+		return errors.Wrapf(ErrAggregationFilterInvalidJSON, "Aggregation %s", body)
+	}
+
+	return nil
+}
+
+// Merge the aggregation's defaults with the values,
+// empty defaults are left out so they end up required.
+func (a AggregationFilter) placeholders(values map[string]string) (map[string]string) {
+	placeholders := make(map[string]string)
+
+	for name, value := range a.Placeholders {
+		if value == "" {
+			continue
+		}
+
+		placeholders[name] = value
+	}
+
+	for name, value := range values {
+		placeholders[name] = value
+	}
+
+	return placeholders
+}
@@ -0,0 +1,194 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"sync"
+)
+
+type AggregationFilters struct {
+	sync.RWMutex
+	aggregations map[string]*AggregationFilter
+}
+
+// Resolve every %{aggregation:name} in query using only the defaults
+func (af *AggregationFilters) Resolve(query string) (string, error) {
+	return af.ResolvePlaceholders(query, nil)
+}
+
+// Resolve every %{aggregation:name} in query then validate the result is JSON.
+// Values from placeholders override the defaults of each aggregation.
+func (af *AggregationFilters) ResolvePlaceholders(query string, placeholders map[string]string) (string, error) {
+	af.RLock()
+	defer af.RUnlock()
+
+	if placeholders == nil {
+		placeholders = make(map[string]string)
+	}
+
+	resolved := replaceJSONPlaceholders(query, AggregationRegexpFunc(af.all(), placeholders))
+
+	err := parsedQueryHasErrors(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	err = validateAggregation(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	return resolved, nil
+}
+
+// Builtins first so user declared aggregations override them
+func (af *AggregationFilters) all() (map[string]*AggregationFilter) {
+	aggregations := make(map[string]*AggregationFilter)
+
+	for name, a := range builtinAggregationFilters {
+		aggregation := &AggregationFilter{}
+		*aggregation = *a
+		aggregation.Builtin = true
+
+		aggregations[name] = aggregation
+	}
+
+	for name, a := range af.aggregations {
+		aggregations[name] = a
+	}
+
+	return aggregations
+}
+
+func (af *AggregationFilters) List() ([]*AggregationFilter) {
+	af.RLock()
+	defer af.RUnlock()
+
+	aggregations := make([]*AggregationFilter, 0)
+
+	for _, a := range af.all() {
+		aggregation := &AggregationFilter{}
+		*aggregation = *a
+
+		aggregation.Placeholders = make(map[string]string)
+		for name, value := range a.Placeholders {
+			aggregation.Placeholders[name] = value
+		}
+
+		aggregations = append(aggregations, aggregation)
+	}
+
+	return aggregations
+}
+
+func (af *AggregationFilters) Add(name, aggregation string, placeholders map[string]string) (error) {
+	af.Lock()
+	defer af.Unlock()
+
+	if _, found := af.aggregations[name]; found {
+		return errors.Errorf("Aggregation %s is already declared", name)
+	}
+
+	a := &AggregationFilter{
+		Name: name,
+		Aggregation: aggregation,
+		Placeholders: make(map[string]string),
+	}
+
+	for k, v := range placeholders {
+		a.Placeholders[k] = v
+	}
+
+	err := parseAggregation(a)
+	if err != nil {
+		return errors.Wrapf(err, "Error parsing aggregation %s", name)
+	}
+
+	af.aggregations[name] = a
+
+	return nil
+}
+
+func (af *AggregationFilters) Get(name string) (string, bool) {
+	af.RLock()
+	defer af.RUnlock()
+
+	if a, found := af.all()[name]; found {
+		return a.Aggregation, true
+	}
+
+	return "", false
+}
+
+// Only delete user declared aggregations, deleting an override
+// brings the built-in one back.
+func (af *AggregationFilters) Delete(name string) (error) {
+	af.Lock()
+	defer af.Unlock()
+
+	if _, found := af.aggregations[name]; found {
+		delete(af.aggregations, name)
+		return nil
+	}
+
+	if _, found := builtinAggregationFilters[name]; found {
+		return errors.Errorf("Aggregation %s is built-in and cannot be deleted", name)
+	}
+
+	return errors.Errorf("Aggregation %s has not been found", name)
+}
+
+func (af *AggregationFilters) ExportConfig() ([]byte, error) {
+	af.RLock()
+	defer af.RUnlock()
+
+	exports := make(map[string]*AggregationFilterExport)
+
+	for name, a := range af.aggregations {
+		exports[name] = &AggregationFilterExport{
+			Aggregation: a.Aggregation,
+			Placeholders: a.Placeholders,
+		}
+	}
+
+	payload, err := json.MarshalIndent(exports, "", "	")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling aggregations to JSON")
+	}
+
+	return payload, nil
+}
+
+func (af *AggregationFilters) ImportConfig(payload []byte) (error) {
+	exports := make(map[string]*AggregationFilterExport)
+	aggregationFilters := NewAggregationFilters()
+
+	err := json.Unmarshal(payload, &exports)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshaling aggregations from JSON")
+	}
+
+	for name, export := range exports {
+		if export == nil {
+			return errors.Errorf("Aggregation %s is empty", name)
+		}
+
+		err := aggregationFilters.Add(name, export.Aggregation, export.Placeholders)
+		if err != nil {
+			return errors.Wrapf(err, "Error processing aggregation %s", name)
+		}
+	}
+
+	af.Lock()
+	defer af.Unlock()
+
+	af.aggregations = aggregationFilters.aggregations
+
+	return nil
+}
+
+func NewAggregationFilters() (*AggregationFilters) {
+	return &AggregationFilters{
+		aggregations: make(map[string]*AggregationFilter),
+	}
+}
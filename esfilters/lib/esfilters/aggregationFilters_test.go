@@ -0,0 +1,86 @@
+package esfilters
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestReplaceJSONPlaceholdersQuoted(t *testing.T) {
+	for _, test := range []struct{
+		body string
+		quoted []bool
+	}{
+		{`{"field":"%{placeholder:a}"}`, []bool{true,},},
+		{`{"size":%{placeholder:a}}`, []bool{false,},},
+		{`{"a":"x\"%{placeholder:a}","b":%{placeholder:b}}`, []bool{true, false,},},
+		{`{"a":"x\\","b":%{placeholder:a}}`, []bool{false,},},
+		{`{"a":"%{placeholder:a}-%{placeholder:b}","c":%{aggregation:c}}`, []bool{true, true, false,},},
+	} {
+		quoted := make([]bool, 0)
+
+		replaceJSONPlaceholders(test.body, func(str string, q bool) (string) {
+			quoted = append(quoted, q)
+			return str
+		})
+
+		if ! reflect.DeepEqual(quoted, test.quoted) {
+			t.Errorf("%s: expected quoted %v, got %v", test.body, test.quoted, quoted)
+		}
+	}
+}
+
+func TestAggregationFiltersResolveEscapesQuotedPlaceholders(t *testing.T) {
+	af := NewAggregationFilters()
+
+	err := af.Add("top", `{"terms":{"field":"%{placeholder:field}","size":%{placeholder:size}}}`, map[string]string{
+		"size": "10",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := `a","script":{"source":"x"},"b":"\`
+
+	for _, test := range []struct{
+		query string
+		expected interface{}
+	}{
+		{`%{aggregation:count}`, map[string]interface{}{
+			"value_count": map[string]interface{}{"field": value,},
+		},},
+		{`%{aggregation:top}`, map[string]interface{}{
+			"terms": map[string]interface{}{"field": value, "size": float64(10),},
+		},},
+		{`{"cardinality":{"field":"%{placeholder:field}"}}`, map[string]interface{}{
+			"cardinality": map[string]interface{}{"field": value,},
+		},},
+	} {
+		resolved, err := af.ResolvePlaceholders(test.query, map[string]string{"field": value,})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.query, err.Error())
+			continue
+		}
+
+		var body interface{}
+
+		err = json.Unmarshal([]byte(resolved), &body)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.query, err.Error())
+			continue
+		}
+
+		if ! reflect.DeepEqual(body, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.expected, body)
+		}
+	}
+}
+
+func TestAggregationFiltersResolveMissingPlaceholder(t *testing.T) {
+	af := NewAggregationFilters()
+
+	_, err := af.ResolvePlaceholders(`%{aggregation:field_uniq_per_terms}`, map[string]string{"field1": "host",})
+	if err == nil {
+		t.Error("expected an error without field2")
+	}
+}
@@ -4,25 +4,170 @@ import (
 	"io/ioutil"
 	"encoding/json"
 	"github.com/tehmoon/errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"fmt"
 )
 
+const (
+	ConfigSectionFilters = "filters"
+	ConfigSectionPlaceholders = "placeholders"
+	ConfigSectionAggregations = "aggregations"
+	ConfigSectionJSONFilters = "json_filters"
+)
+
+var configSections = []string{
+	ConfigSectionFilters,
+	ConfigSectionPlaceholders,
+	ConfigSectionAggregations,
+	ConfigSectionJSONFilters,
+}
+
+func isConfigSection(section string) (bool) {
+	for _, s := range configSections {
+		if s == section {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Config can be made of several files: the included files and the files
+// passed to ImportConfigFromFiles are layered in order, the last file being
+// the top-level one. Entries from later layers override earlier ones.
+// Only the entries from the top-level file are exported so included files
+// are never changed.
 type Config struct {
 	Filters *QueryFilters
+	Aggregations *AggregationFilters
+	JSONFilters *JSONFilters
+	Include []string
+	Overrides []*ConfigOverride
+	file string
+	origins map[string]map[string]string
+	layers []*configLayer
 }
 
-func (c Config) ExportConfig() ([]byte, error) {
-	var (
-		filters json.RawMessage
-		err error
-	)
+// An entry of a layer replaced by the same entry in a later layer
+type ConfigOverride struct {
+	Section string
+	Name string
+	File string
+	Overridden string
+}
+
+func (o ConfigOverride) String() (string) {
+	return fmt.Sprintf("%s %s from %s overrides %s", o.Section, o.Name, o.File, o.Overridden)
+}
+
+// Top-level file, the one ExportConfigToFile should write to
+func (c Config) File() (string) {
+	return c.file
+}
+
+// Every file the config has been read from, included files first
+func (c Config) Files() ([]string) {
+	files := make([]string, 0, len(c.layers))
+
+	for _, layer := range c.layers {
+		files = append(files, layer.file)
+	}
+
+	return files
+}
+
+func (c *Config) SetFile(p string) {
+	c.file = p
+	c.Include = nil
+
+	for _, layer := range c.layers {
+		if layer.file == p {
+			c.Include = layer.raw.Include
+		}
+	}
+}
+
+// File declaring the entry, entries created since
+// the import belong to the top-level file.
+func (c Config) Origin(section, name string) (string) {
+	if origin, found := c.origins[section][name]; found {
+		return origin
+	}
+
+	return c.file
+}
+
+// Returns an error if the entry comes from an included file
+// because the change would not be written.
+func (c Config) AssertOwned(section, name string) (error) {
+	if origin := c.Origin(section, name); origin != c.file {
+		return errors.Errorf("%s %s comes from %s, only %s can be changed", section, name, origin, c.file)
+	}
+
+	return nil
+}
+
+// Replace the entries of the top-level file with data,
+// the included files are kept.
+func (c *Config) ImportTopLevelConfig(data []byte) (error) {
+	loader := newConfigLoader()
+
+	for _, layer := range c.layers {
+		if layer.file == c.file {
+			continue
+		}
+
+		abs, err := filepath.Abs(layer.file)
+		if err != nil {
+			return errors.Wrapf(err, "Error finding absolute path of %s", layer.file)
+		}
+
+		loader.layers = append(loader.layers, layer)
+		loader.loaded[abs] = true
+	}
+
+	err := loader.load(data, c.file)
+	if err != nil {
+		return err
+	}
 
-	filters, err = c.Filters.ExportConfig()
+	config, err := loader.config(c.file)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error exporting filters")
+		return err
+	}
+
+	*c = *config
+
+	return nil
+}
+
+func (c Config) ExportConfig() ([]byte, error) {
+	payloads := make(map[string]*json.RawMessage)
+
+	for section, importExporter := range c.importExporters() {
+		payload, err := importExporter.ExportConfig()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error exporting %s", section)
+		}
+
+		message := json.RawMessage(payload)
+
+		err = c.exportOwned(section, &message)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error exporting %s", section)
+		}
+
+		payloads[section] = &message
 	}
 
 	raw := &ConfigRaw{
-		Filters: &filters,
+		Include: c.Include,
+		Filters: payloads[ConfigSectionFilters],
+		Placeholders: payloads[ConfigSectionPlaceholders],
+		Aggregations: payloads[ConfigSectionAggregations],
+		JSONFilters: payloads[ConfigSectionJSONFilters],
 	}
 
 	payload, err := json.MarshalIndent(raw, "", "  ")
@@ -33,12 +178,90 @@ func (c Config) ExportConfig() ([]byte, error) {
 	return payload, nil
 }
 
+// Drop the entries that are left untouched since they
+// have been imported from an included file.
+func (c Config) exportOwned(section string, payload *json.RawMessage) (error) {
+	values := make(map[string]json.RawMessage)
+
+	err := json.Unmarshal(*payload, &values)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		if c.Origin(section, name) == c.file {
+			continue
+		}
+
+		layered, found := c.layeredValue(section, name)
+		if ! found {
+			continue
+		}
+
+		equal, err := jsonEqual(value, layered)
+		if err != nil {
+			return err
+		}
+
+		if equal {
+			delete(values, name)
+		}
+	}
+
+	data, err := json.MarshalIndent(values, "", "	")
+	if err != nil {
+		return err
+	}
+
+	*payload = data
+
+	return nil
+}
+
+// Value of the entry before the top-level file overrides it
+func (c Config) layeredValue(section, name string) (json.RawMessage, bool) {
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		layer := c.layers[i]
+		if layer.file == c.file {
+			continue
+		}
+
+		if value, found := layer.values[section][name]; found {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+func jsonEqual(a, b json.RawMessage) (bool, error) {
+	var va, vb interface{}
+
+	err := json.Unmarshal(a, &va)
+	if err != nil {
+		return false, err
+	}
+
+	err = json.Unmarshal(b, &vb)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(va, vb), nil
+}
+
+// The file is written in the format of its extension
 func (c Config) ExportConfigToFile(p string) (error) {
 	payload, err := c.ExportConfig()
 	if err != nil {
 		return errors.Wrap(err, "Error exporting config")
 	}
 
+	payload, err = configEncode(payload, ConfigFormat(p))
+	if err != nil {
+		return errors.Wrapf(err, "Error encoding config for %s", p)
+	}
+
 	err = ioutil.WriteFile(p, payload, 0600)
 	if err != nil {
 		return errors.Wrap(err, "Error writing config to file")
@@ -48,38 +271,233 @@ func (c Config) ExportConfigToFile(p string) (error) {
 }
 
 type ConfigRaw struct {
+	Include []string `json:"include,omitempty"`
 	Filters *json.RawMessage `json:"filters"`
+	Placeholders *json.RawMessage `json:"placeholders,omitempty"`
+	Aggregations *json.RawMessage `json:"aggregations,omitempty"`
+	JSONFilters *json.RawMessage `json:"json_filters,omitempty"`
 }
 
-func ImportConfigFromFile(p string) (*Config, error) {
+func (raw ConfigRaw) sections() (map[string]*json.RawMessage) {
+	return map[string]*json.RawMessage{
+		ConfigSectionFilters: raw.Filters,
+		ConfigSectionPlaceholders: raw.Placeholders,
+		ConfigSectionAggregations: raw.Aggregations,
+		ConfigSectionJSONFilters: raw.JSONFilters,
+	}
+}
+
+type configLayer struct {
+	file string
+	raw *ConfigRaw
+	values map[string]map[string]json.RawMessage
+}
+
+// Reads the files and their includes, includes come before the file
+// including them. A file is only loaded once.
+type configLoader struct {
+	layers []*configLayer
+	loaded map[string]bool
+	stack []string
+}
+
+func newConfigLoader() (*configLoader) {
+	return &configLoader{
+		layers: make([]*configLayer, 0),
+		loaded: make(map[string]bool),
+		stack: make([]string, 0),
+	}
+}
+
+func (l *configLoader) loadFile(p string) (error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return errors.Wrapf(err, "Error finding absolute path of %s", p)
+	}
+
+	for _, file := range l.stack {
+		if file == abs {
+			return errors.Errorf("File %s is included in a cycle", p)
+		}
+	}
+
+	if l.loaded[abs] {
+		return nil
+	}
+
 	data, err := ioutil.ReadFile(p)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error reading file")
+		return errors.Wrap(err, "Error reading file")
 	}
 
-	return ImportConfig(data)
-}
+	data, err = configDecode(data, ConfigFormat(p))
+	if err != nil {
+		return errors.Wrapf(err, "Error decoding file %s", p)
+	}
 
-func ImportConfig(data []byte) (*Config, error) {
-	config := NewConfig()
+	l.stack = append(l.stack, abs)
+	defer func() {
+		l.stack = l.stack[:len(l.stack) - 1]
+	}()
+
+	err = l.load(data, p)
+	if err != nil {
+		return errors.Wrapf(err, "Error loading file %s", p)
+	}
 
+	l.loaded[abs] = true
+
+	return nil
+}
+
+// Includes are relative to the directory of p
+func (l *configLoader) load(data []byte, p string) (error) {
 	raw := &ConfigRaw{}
 
 	err := json.Unmarshal(data, &raw)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error unmarshaling data to JSON")
+		return errors.Wrap(err, "Error unmarshaling data to JSON")
 	}
 
-	err = config.Filters.ImportConfig([]byte(*raw.Filters))
-	if err != nil {
-		return nil, errors.Wrap(err, "Error importing filters")
+	layer := &configLayer{
+		file: p,
+		raw: raw,
+		values: make(map[string]map[string]json.RawMessage),
+	}
+
+	for section, payload := range raw.sections() {
+		values := make(map[string]json.RawMessage)
+
+		if payload != nil {
+			err = json.Unmarshal(*payload, &values)
+			if err != nil {
+				return errors.Wrapf(err, "Error unmarshaling %s", section)
+			}
+		}
+
+		layer.values[section] = values
+	}
+
+	dir := filepath.Dir(p)
+
+	for _, include := range raw.Include {
+		if ! filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+
+		err = l.loadFile(include)
+		if err != nil {
+			return errors.Wrapf(err, "Error including %s", include)
+		}
+	}
+
+	l.layers = append(l.layers, layer)
+
+	return nil
+}
+
+// Merge every layer section by section then import
+// the result so filters can reference filters from any layer.
+func (l *configLoader) config(file string) (*Config, error) {
+	config := NewConfig()
+	config.layers = l.layers
+	config.SetFile(file)
+
+	merged := make(map[string]map[string]json.RawMessage)
+	for _, section := range configSections {
+		merged[section] = make(map[string]json.RawMessage)
+	}
+
+	for _, layer := range l.layers {
+		for section, values := range layer.values {
+			for name, value := range values {
+				if origin, found := config.origins[section][name]; found && origin != layer.file {
+					config.Overrides = append(config.Overrides, &ConfigOverride{
+						Section: section,
+						Name: name,
+						File: layer.file,
+						Overridden: origin,
+					})
+				}
+
+				merged[section][name] = value
+				config.origins[section][name] = layer.file
+			}
+		}
+	}
+
+	sort.Slice(config.Overrides, func(i, j int) (bool) {
+		if config.Overrides[i].Section != config.Overrides[j].Section {
+			return config.Overrides[i].Section < config.Overrides[j].Section
+		}
+
+		return config.Overrides[i].Name < config.Overrides[j].Name
+	})
+
+	importExporters := config.importExporters()
+
+	for _, section := range configSections {
+		payload, err := json.Marshal(merged[section])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error marshaling %s to JSON", section)
+		}
+
+		err = importExporters[section].ImportConfig(payload)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error importing %s", section)
+		}
 	}
 
 	return config, nil
 }
 
+func ImportConfigFromFile(p string) (*Config, error) {
+	return ImportConfigFromFiles(p)
+}
+
+// Layer the files in order, the last one is the top-level file
+func ImportConfigFromFiles(files ...string) (*Config, error) {
+	if len(files) == 0 {
+		return NewConfig(), nil
+	}
+
+	loader := newConfigLoader()
+
+	for _, file := range files {
+		err := loader.loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return loader.config(files[len(files) - 1])
+}
+
+// Included files are relative to the current directory
+func ImportConfig(data []byte) (*Config, error) {
+	loader := newConfigLoader()
+
+	err := loader.load(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return loader.config("")
+}
+
 func NewConfig() (*Config) {
-	return &Config{
+	config := &Config{
 		Filters: NewQueryFilters(),
+		Aggregations: NewAggregationFilters(),
+		JSONFilters: NewJSONFilters(),
+		Overrides: make([]*ConfigOverride, 0),
+		origins: make(map[string]map[string]string),
+		layers: make([]*configLayer, 0),
 	}
+
+	for _, section := range configSections {
+		config.origins[section] = make(map[string]string)
+	}
+
+	return config
 }
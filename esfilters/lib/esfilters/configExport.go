@@ -1,5 +1,95 @@
 package esfilters
 
+import (
+	"encoding/json"
+	"bytes"
+)
+
 type ConfigExport struct {
-	Filters map[string]string `json:"filters"`
+	Filters map[string]*QueryFilterExport `json:"filters"`
+	Placeholders map[string]string `json:"placeholders"`
+	Aggregations map[string]*AggregationFilterExport `json:"aggregations"`
+	JSONFilters map[string]string `json:"json_filters"`
+}
+
+type AggregationFilterExport struct {
+	Aggregation string `json:"aggregation"`
+	Placeholders map[string]string `json:"placeholders,omitempty"`
+}
+
+// A filter is exported as its query string unless it has metadata,
+// then it is exported as an object. Both forms are imported.
+type QueryFilterExport struct {
+	Query string `json:"query,omitempty"`
+	DSL json.RawMessage `json:"dsl,omitempty"`
+	QueryFilterMetadata
+}
+
+type queryFilterExportObject QueryFilterExport
+
+func (e QueryFilterExport) MarshalJSON() ([]byte, error) {
+	if e.DSL == nil && e.QueryFilterMetadata.IsZero() {
+		return json.Marshal(e.Query)
+	}
+
+	return json.Marshal(queryFilterExportObject(e))
+}
+
+func (e *QueryFilterExport) UnmarshalJSON(data []byte) (error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*e = QueryFilterExport{}
+
+		return json.Unmarshal(data, &e.Query)
+	}
+
+	object := queryFilterExportObject{}
+
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return err
+	}
+
+	*e = QueryFilterExport(object)
+
+	return nil
+}
+
+func (e QueryFilterExport) copy() (*QueryFilterExport) {
+	e.QueryFilterMetadata = e.QueryFilterMetadata.copy()
+
+	return &e
+}
+
+// Same filter once marshaled, whatever the format it was written in
+func (e *QueryFilterExport) equal(export *QueryFilterExport) (bool, error) {
+	a, err := json.Marshal(e)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := json.Marshal(export)
+	if err != nil {
+		return false, err
+	}
+
+	return jsonEqual(a, b)
+}
+
+// Queries of the exports, DSL fragments as text. The graph
+// and the linter only need them to find the references.
+func queryFilterExportsQueries(exports map[string]*QueryFilterExport) (map[string]string) {
+	queries := make(map[string]string)
+
+	for name, export := range exports {
+		switch {
+			case export == nil:
+				queries[name] = ""
+			case export.DSL != nil:
+				queries[name] = string(export.DSL)
+			default:
+				queries[name] = export.Query
+		}
+	}
+
+	return queries
 }
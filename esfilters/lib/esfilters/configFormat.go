@@ -0,0 +1,151 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"gopkg.in/yaml.v2"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"bytes"
+	"fmt"
+)
+
+// Config files are handled as JSON, the other formats are
+// converted when the files are read and written.
+const (
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+)
+
+// Format of the config file from its extension, JSON by default
+func ConfigFormat(p string) (string) {
+	switch strings.ToLower(filepath.Ext(p)) {
+		case ".yaml", ".yml":
+			return ConfigFormatYAML
+	}
+
+	return ConfigFormatJSON
+}
+
+// Convert the content of a config file to JSON
+func configDecode(data []byte, format string) ([]byte, error) {
+	if format != ConfigFormatYAML {
+		return data, nil
+	}
+
+	var v interface{}
+
+	err := yaml.Unmarshal(data, &v)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling data from YAML")
+	}
+
+	payload, err := json.Marshal(yamlToJSON(v))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling data to JSON")
+	}
+
+	return payload, nil
+}
+
+// Convert an exported config to the format of the file. Keys are written
+// in the order of the JSON payload so the files only change with the config.
+func configEncode(payload []byte, format string) ([]byte, error) {
+	if format != ConfigFormatYAML {
+		return payload, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	v, err := jsonToYAML(decoder)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling data from JSON")
+	}
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling data to YAML")
+	}
+
+	return data, nil
+}
+
+// YAML mappings can have any key, JSON objects only string keys
+func yamlToJSON(v interface{}) (interface{}) {
+	switch v := v.(type) {
+		case map[interface{}]interface{}:
+			m := make(map[string]interface{})
+
+			for key, value := range v {
+				m[fmt.Sprint(key)] = yamlToJSON(value)
+			}
+
+			return m
+		case []interface{}:
+			for i, value := range v {
+				v[i] = yamlToJSON(value)
+			}
+	}
+
+	return v
+}
+
+// Objects become yaml.MapSlice to keep their key order
+func jsonToYAML(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+		case json.Delim:
+			switch token {
+				case '{':
+					m := yaml.MapSlice{}
+
+					for decoder.More() {
+						key, err := decoder.Token()
+						if err != nil {
+							return nil, err
+						}
+
+						value, err := jsonToYAML(decoder)
+						if err != nil {
+							return nil, err
+						}
+
+						m = append(m, yaml.MapItem{Key: key, Value: value})
+					}
+
+					_, err = decoder.Token()
+
+					return m, err
+				case '[':
+					s := make([]interface{}, 0)
+
+					for decoder.More() {
+						value, err := jsonToYAML(decoder)
+						if err != nil {
+							return nil, err
+						}
+
+						s = append(s, value)
+					}
+
+					_, err = decoder.Token()
+
+					return s, err
+			}
+
+			return nil, errors.Errorf("Unexpected delimiter %s", token)
+		case json.Number:
+			if i, err := token.Int64(); err == nil {
+				return i, nil
+			}
+
+			return token.Float64()
+	}
+
+	return token, nil
+}
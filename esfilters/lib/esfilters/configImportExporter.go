@@ -1,10 +1,42 @@
 package esfilters
 
+// A section of the config file. Implementations are safe for concurrent
+// use: ImportConfig replaces every entry at once under the write lock.
 type ConfigImportExporter interface {
 	ExportConfig() ([]byte, error)
 	ImportConfig([]byte) (error)
 	RLock()
-	Runlock()
+	RUnlock()
 	Lock()
 	Unlock()
 }
+
+var (
+	_ ConfigImportExporter = (*QueryFilters)(nil)
+	_ ConfigImportExporter = (*AggregationFilters)(nil)
+	_ ConfigImportExporter = (*JSONFilters)(nil)
+	_ ConfigImportExporter = queryFilterPlaceholders{}
+)
+
+// The placeholders section is stored along with the filters
+type queryFilterPlaceholders struct {
+	*QueryFilters
+}
+
+func (p queryFilterPlaceholders) ExportConfig() ([]byte, error) {
+	return p.ExportPlaceholdersConfig()
+}
+
+func (p queryFilterPlaceholders) ImportConfig(payload []byte) (error) {
+	return p.ImportPlaceholdersConfig(payload)
+}
+
+// Every section of the config by name
+func (c Config) importExporters() (map[string]ConfigImportExporter) {
+	return map[string]ConfigImportExporter{
+		ConfigSectionFilters: c.Filters,
+		ConfigSectionPlaceholders: queryFilterPlaceholders{c.Filters},
+		ConfigSectionAggregations: c.Aggregations,
+		ConfigSectionJSONFilters: c.JSONFilters,
+	}
+}
@@ -0,0 +1,226 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sort"
+	"fmt"
+)
+
+var ErrConfigSnapshotConflict error = errors.New("conflicting changes")
+
+// Entries of a config file keyed by section:name. Version is the version
+// of the storage document the entry has been read from, 0 when it has
+// never been pushed.
+type ConfigSnapshot struct {
+	Entries map[string]*ConfigSnapshotEntry `json:"entries"`
+}
+
+type ConfigSnapshotEntry struct {
+	Section string `json:"section"`
+	Name string `json:"name"`
+	Value json.RawMessage `json:"value"`
+	Version int64 `json:"version"`
+}
+
+func configSnapshotId(section, name string) (string) {
+	return fmt.Sprintf("%s:%s", section, name)
+}
+
+func (e *ConfigSnapshotEntry) equal(entry *ConfigSnapshotEntry) (bool, error) {
+	if e == nil || entry == nil {
+		return e == entry, nil
+	}
+
+	return jsonEqual(e.Value, entry.Value)
+}
+
+func (s *ConfigSnapshot) Add(entry *ConfigSnapshotEntry) {
+	s.Entries[configSnapshotId(entry.Section, entry.Name)] = entry
+}
+
+func (s ConfigSnapshot) ids() ([]string) {
+	ids := make([]string, 0, len(s.Entries))
+
+	for id := range s.Entries {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (s ConfigSnapshot) ExportToFile(p string) (error) {
+	payload, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error marshaling snapshot to JSON")
+	}
+
+	err = ioutil.WriteFile(p, payload, 0600)
+	if err != nil {
+		return errors.Wrap(err, "Error writing snapshot to file")
+	}
+
+	return nil
+}
+
+func ImportConfigSnapshotFromFile(p string) (*ConfigSnapshot, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading file")
+	}
+
+	snapshot := NewConfigSnapshot()
+
+	err = json.Unmarshal(data, snapshot)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling snapshot from JSON")
+	}
+
+	if snapshot.Entries == nil {
+		snapshot.Entries = make(map[string]*ConfigSnapshotEntry)
+	}
+
+	return snapshot, nil
+}
+
+// Snapshot of a config in the file format, entries have no version
+func NewConfigSnapshotFromConfig(data []byte) (*ConfigSnapshot, error) {
+	raw := &ConfigRaw{}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling data to JSON")
+	}
+
+	snapshot := NewConfigSnapshot()
+
+	for section, payload := range raw.sections() {
+		if payload == nil {
+			continue
+		}
+
+		values := make(map[string]json.RawMessage)
+
+		err = json.Unmarshal(*payload, &values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error unmarshaling %s", section)
+		}
+
+		for name, value := range values {
+			snapshot.Add(&ConfigSnapshotEntry{
+				Section: section,
+				Name: name,
+				Value: value,
+			})
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Three-way merge of the local config with the remote snapshot, base being
+// the snapshot of the last pull. Entries changed on both sides are conflicts
+// unless force is set, then the remote entries win.
+// Returns the merged config in the file format.
+func MergeConfigSnapshot(local []byte, base, remote *ConfigSnapshot, force bool) ([]byte, error) {
+	raw := &ConfigRaw{}
+
+	err := json.Unmarshal(local, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling data to JSON")
+	}
+
+	current, err := NewConfigSnapshotFromConfig(local)
+	if err != nil {
+		return nil, err
+	}
+
+	all := NewConfigSnapshot()
+	for _, snapshot := range []*ConfigSnapshot{base, remote, current} {
+		for id, entry := range snapshot.Entries {
+			all.Entries[id] = entry
+		}
+	}
+
+	merged := NewConfigSnapshot()
+	conflicts := make([]string, 0)
+
+	for _, id := range all.ids() {
+		localEntry, baseEntry, remoteEntry := current.Entries[id], base.Entries[id], remote.Entries[id]
+
+		unchangedLocally, err := localEntry.equal(baseEntry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error comparing %s", id)
+		}
+
+		unchangedRemotely, err := remoteEntry.equal(baseEntry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error comparing %s", id)
+		}
+
+		same, err := localEntry.equal(remoteEntry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error comparing %s", id)
+		}
+
+		entry := remoteEntry
+
+		switch {
+			case unchangedLocally, same:
+			case unchangedRemotely:
+				entry = localEntry
+			case ! force:
+				conflicts = append(conflicts, id)
+		}
+
+		if entry != nil {
+			merged.Add(entry)
+		}
+	}
+
+	if len(conflicts) != 0 {
+		return nil, errors.Wrapf(ErrConfigSnapshotConflict, "Entries changed locally and remotely: %s", strings.Join(conflicts, ", "))
+	}
+
+	sections := make(map[string]map[string]json.RawMessage)
+	for _, section := range configSections {
+		sections[section] = make(map[string]json.RawMessage)
+	}
+
+	for _, entry := range merged.Entries {
+		sections[entry.Section][entry.Name] = entry.Value
+	}
+
+	payloads := make(map[string]*json.RawMessage)
+	for section, values := range sections {
+		payload, err := json.Marshal(values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error marshaling %s to JSON", section)
+		}
+
+		message := json.RawMessage(payload)
+		payloads[section] = &message
+	}
+
+	raw.Filters = payloads[ConfigSectionFilters]
+	raw.Placeholders = payloads[ConfigSectionPlaceholders]
+	raw.Aggregations = payloads[ConfigSectionAggregations]
+	raw.JSONFilters = payloads[ConfigSectionJSONFilters]
+
+	payload, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling config to JSON")
+	}
+
+	return payload, nil
+}
+
+func NewConfigSnapshot() (*ConfigSnapshot) {
+	return &ConfigSnapshot{
+		Entries: make(map[string]*ConfigSnapshotEntry),
+	}
+}
@@ -0,0 +1,127 @@
+package esfilters
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func newTestConfigSnapshotEntry(value string) (*ConfigSnapshotEntry) {
+	return &ConfigSnapshotEntry{
+		Section: ConfigSectionFilters,
+		Name: "errors",
+		Value: json.RawMessage(value),
+	}
+}
+
+func TestConfigSnapshotEntryEqual(t *testing.T) {
+	for _, test := range []struct{
+		name string
+		a *ConfigSnapshotEntry
+		b *ConfigSnapshotEntry
+		equal bool
+	}{
+		{"both missing", nil, nil, true,},
+		{"added", newTestConfigSnapshotEntry(`"status:500"`), nil, false,},
+		{"removed", nil, newTestConfigSnapshotEntry(`"status:500"`), false,},
+		{"same value", newTestConfigSnapshotEntry(`"status:500"`), newTestConfigSnapshotEntry(`"status:500"`), true,},
+		{"changed value", newTestConfigSnapshotEntry(`"status:500"`), newTestConfigSnapshotEntry(`"status:404"`), false,},
+		{"other formatting", newTestConfigSnapshotEntry(`{"a":1,"b":[1,2]}`), newTestConfigSnapshotEntry(`{ "b": [1, 2], "a": 1 }`), true,},
+		{"other order in array", newTestConfigSnapshotEntry(`[1,2]`), newTestConfigSnapshotEntry(`[2,1]`), false,},
+		{"other type", newTestConfigSnapshotEntry(`"1"`), newTestConfigSnapshotEntry(`1`), false,},
+	} {
+		equal, err := test.a.equal(test.b)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if equal != test.equal {
+			t.Errorf("%s: expected equal to be %t, got %t", test.name, test.equal, equal)
+		}
+	}
+}
+
+func TestConfigSnapshotEntryEqualInvalid(t *testing.T) {
+	_, err := newTestConfigSnapshotEntry(`{`).equal(newTestConfigSnapshotEntry(`{}`))
+	if err == nil {
+		t.Error("expected an error comparing invalid JSON")
+	}
+}
+
+func TestConfigSnapshotIds(t *testing.T) {
+	snapshot := NewConfigSnapshot()
+
+	if ids := snapshot.ids(); len(ids) != 0 {
+		t.Errorf("expected no ids for an empty snapshot, got %v", ids)
+	}
+
+	for _, entry := range []*ConfigSnapshotEntry{
+		{Section: ConfigSectionPlaceholders, Name: "env",},
+		{Section: ConfigSectionFilters, Name: "errors",},
+		{Section: ConfigSectionFilters, Name: "base",},
+		{Section: ConfigSectionAggregations, Name: "by_host",},
+		{Section: ConfigSectionFilters, Name: "base",},
+	} {
+		snapshot.Add(entry)
+	}
+
+	expected := []string{
+		"aggregations:by_host",
+		"filters:base",
+		"filters:errors",
+		"placeholders:env",
+	}
+
+	if ids := snapshot.ids(); ! reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected ids %v, got %v", expected, ids)
+	}
+}
+
+// Entries of two versions of a config, compared like Push does
+func TestConfigSnapshotDiff(t *testing.T) {
+	base, err := NewConfigSnapshotFromConfig([]byte(`{
+  "filters": {"base": "host:example", "errors": "status:>=500", "removed": "a"},
+  "placeholders": {"env": "prod"}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := NewConfigSnapshotFromConfig([]byte(`{
+  "filters": {"base": "host:example", "errors": "status:>=400", "added": "b"},
+  "placeholders": {"env":   "prod"}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make([]string, 0)
+
+	for _, id := range current.ids() {
+		same, err := current.Entries[id].equal(base.Entries[id])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ! same {
+			changed = append(changed, id)
+		}
+	}
+
+	removed := make([]string, 0)
+
+	for _, id := range base.ids() {
+		if _, found := current.Entries[id]; ! found {
+			removed = append(removed, id)
+		}
+	}
+
+	if expected := []string{"filters:added", "filters:errors",}; ! reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected changed entries %v, got %v", expected, changed)
+	}
+
+	if expected := []string{"filters:removed",}; ! reflect.DeepEqual(removed, expected) {
+		t.Errorf("expected removed entries %v, got %v", expected, removed)
+	}
+}
@@ -0,0 +1,259 @@
+package esfilters
+
+import (
+	"gopkg.in/olivere/elastic.v5"
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"context"
+	"strings"
+	"io"
+)
+
+const configStorageType = "entry"
+
+// The value is stored as a string and not indexed, its JSON
+// type differs from one section to another.
+const configStorageMapping = `{
+  "mappings": {
+    "entry": {
+      "properties": {
+        "section": {"type": "keyword"},
+        "name": {"type": "keyword"},
+        "value": {"type": "text", "index": false}
+      }
+    }
+  }
+}`
+
+// Shares the config entries through an elasticsearch index, one document
+// per entry. Documents are written with the version they have been pulled
+// with so concurrent changes are refused instead of overwritten.
+type ConfigStorage struct {
+	client *elastic.Client
+	index string
+}
+
+type configStorageDocument struct {
+	Section string `json:"section"`
+	Name string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (s ConfigStorage) CreateIndex(ctx context.Context) (error) {
+	exists, err := s.client.IndexExists(s.index).Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "Error checking if index %s exists", s.index)
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = s.client.CreateIndex(s.index).
+		BodyString(configStorageMapping).
+		Do(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "Error creating index %s", s.index)
+	}
+
+	return nil
+}
+
+// Every entry of the index with its document version
+func (s ConfigStorage) Pull(ctx context.Context) (*ConfigSnapshot, error) {
+	snapshot := NewConfigSnapshot()
+
+	exists, err := s.client.IndexExists(s.index).Do(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error checking if index %s exists", s.index)
+	}
+
+	if ! exists {
+		return snapshot, nil
+	}
+
+	scroll := s.client.Scroll(s.index).
+		Query(elastic.NewMatchAllQuery()).
+		Version(true).
+		Size(500).
+		Scroll("10s")
+
+	scrollId := ""
+
+	for {
+		res, err := scroll.Do(ctx)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, errors.Wrap(err, "Error scrolling config entries")
+		}
+
+		scrollId = res.ScrollId
+
+		for _, hit := range res.Hits.Hits {
+			entry, err := newConfigSnapshotEntryFromHit(hit)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error reading document %s", hit.Id)
+			}
+
+			snapshot.Add(entry)
+		}
+
+		scroll.ScrollId(scrollId)
+	}
+
+	if scrollId != "" {
+		_, err = s.client.ClearScroll(scrollId).Do(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error clearing the scroll %s", scrollId)
+		}
+	}
+
+	return snapshot, nil
+}
+
+func newConfigSnapshotEntryFromHit(hit *elastic.SearchHit) (*ConfigSnapshotEntry, error) {
+	if hit.Source == nil || hit.Version == nil {
+		return nil, errors.New("Document has no source or no version")
+	}
+
+	document := &configStorageDocument{}
+
+	err := json.Unmarshal(*hit.Source, document)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling document")
+	}
+
+	// Merging would have nowhere to put the entry
+	if ! isConfigSection(document.Section) {
+		return nil, errors.Errorf("Unknown section %q", document.Section)
+	}
+
+	return &ConfigSnapshotEntry{
+		Section: document.Section,
+		Name: document.Name,
+		Value: json.RawMessage(document.Value),
+		Version: *hit.Version,
+	}, nil
+}
+
+// Write the entries of local, a config in the file format, that changed
+// since base was pulled. Entries removed from local are deleted.
+// Returns the new snapshot to use as base, it is also returned when some
+// entries are conflicting so the other changes are not pushed twice.
+func (s ConfigStorage) Push(ctx context.Context, local []byte, base *ConfigSnapshot) (*ConfigSnapshot, error) {
+	current, err := NewConfigSnapshotFromConfig(local)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.CreateIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pushed := NewConfigSnapshot()
+	for id, entry := range base.Entries {
+		pushed.Entries[id] = entry
+	}
+
+	conflicts := make([]string, 0)
+
+	for _, id := range current.ids() {
+		entry, baseEntry := current.Entries[id], base.Entries[id]
+
+		same, err := entry.equal(baseEntry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error comparing %s", id)
+		}
+
+		if same {
+			continue
+		}
+
+		version, err := s.write(ctx, id, entry, baseEntry)
+		if err != nil {
+			if elastic.IsConflict(err) {
+				conflicts = append(conflicts, id)
+				continue
+			}
+
+			return pushed, errors.Wrapf(err, "Error pushing %s", id)
+		}
+
+		entry.Version = version
+		pushed.Entries[id] = entry
+	}
+
+	for _, id := range base.ids() {
+		if _, found := current.Entries[id]; found {
+			continue
+		}
+
+		_, err := s.client.Delete().
+			Index(s.index).
+			Type(configStorageType).
+			Id(id).
+			Version(base.Entries[id].Version).
+			Refresh("true").
+			Do(ctx)
+		if err != nil && ! elastic.IsNotFound(err) {
+			if elastic.IsConflict(err) {
+				conflicts = append(conflicts, id)
+				continue
+			}
+
+			return pushed, errors.Wrapf(err, "Error deleting %s", id)
+		}
+
+		delete(pushed.Entries, id)
+	}
+
+	if len(conflicts) != 0 {
+		return pushed, errors.Wrapf(ErrConfigSnapshotConflict, "Entries changed remotely since the last pull: %s", strings.Join(conflicts, ", "))
+	}
+
+	return pushed, nil
+}
+
+// New entries are created, the others are only replaced
+// if the document is still at the version of base.
+func (s ConfigStorage) write(ctx context.Context, id string, entry, base *ConfigSnapshotEntry) (int64, error) {
+	value, err := json.Marshal(entry.Value)
+	if err != nil {
+		return 0, err
+	}
+
+	service := s.client.Index().
+		Index(s.index).
+		Type(configStorageType).
+		Id(id).
+		BodyJson(&configStorageDocument{
+			Section: entry.Section,
+			Name: entry.Name,
+			Value: string(value),
+		}).
+		Refresh("true")
+
+	if base == nil {
+		service = service.OpType("create")
+	} else {
+		service = service.Version(base.Version)
+	}
+
+	res, err := service.Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Version, nil
+}
+
+func NewConfigStorage(client *elastic.Client, index string) (*ConfigStorage) {
+	return &ConfigStorage{
+		client: client,
+		index: index,
+	}
+}
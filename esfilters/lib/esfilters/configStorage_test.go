@@ -0,0 +1,45 @@
+package esfilters
+
+import (
+	"encoding/json"
+	"testing"
+	"gopkg.in/olivere/elastic.v5"
+)
+
+func newTestSearchHit(source string, version int64) (*elastic.SearchHit) {
+	raw := json.RawMessage(source)
+
+	return &elastic.SearchHit{
+		Id: "test",
+		Source: &raw,
+		Version: &version,
+	}
+}
+
+func TestNewConfigSnapshotEntryFromHit(t *testing.T) {
+	entry, err := newConfigSnapshotEntryFromHit(newTestSearchHit(`{"section":"filters","name":"errors","value":"\"status:>=500\""}`, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Section != ConfigSectionFilters || entry.Name != "errors" || string(entry.Value) != `"status:>=500"` || entry.Version != 3 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestNewConfigSnapshotEntryFromHitInvalid(t *testing.T) {
+	for _, test := range []struct{
+		name string
+		hit *elastic.SearchHit
+	}{
+		{"unknown section", newTestSearchHit(`{"section":"bogus","name":"errors","value":"\"a\""}`, 1),},
+		{"no section", newTestSearchHit(`{"name":"errors","value":"\"a\""}`, 1),},
+		{"invalid source", newTestSearchHit(`{`, 1),},
+		{"no source", &elastic.SearchHit{Id: "test",},},
+	} {
+		_, err := newConfigSnapshotEntryFromHit(test.hit)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+)
+
+type JSONFilter struct {
+	Name string
+	Path string
+	ParsedPath *JSONPath
+}
+
+var (
+	ErrJSONFilterValueNotFound error = errors.New("JSON filter not found")
+)
+
+func parseJSONFilter(f *JSONFilter) (error) {
+	if ok := QueryRegexpName.MatchString(f.Name); ! ok {
+		return errors.Errorf("Invalid name %s", f.Name)
+	}
+
+	path, err := ParseJSONPath(f.Path)
+	if err != nil {
+		return err
+	}
+
+	f.ParsedPath = path
+
+	return nil
+}
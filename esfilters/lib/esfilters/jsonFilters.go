@@ -0,0 +1,156 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"sync"
+)
+
+type JSONFilters struct {
+	sync.RWMutex
+	filters map[string]*JSONFilter
+}
+
+// Extract the value of the filter name from v, v being
+// an unmarshaled JSON document like an elasticsearch hit.
+func (jf *JSONFilters) Resolve(name string, v interface{}) (interface{}, error) {
+	jf.RLock()
+	f, found := jf.filters[name]
+	jf.RUnlock()
+
+	if ! found {
+		return nil, errors.Wrapf(ErrJSONFilterValueNotFound, "JSON filter %s has not been found", name)
+	}
+
+	return f.ParsedPath.Extract(v)
+}
+
+// Same as Resolve but strings are returned as is
+// and everything else is marshaled to JSON.
+func (jf *JSONFilters) ResolveString(name string, v interface{}) (string, error) {
+	value, err := jf.Resolve(name, v)
+	if err != nil {
+		return "", err
+	}
+
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.Wrap(err, "Error marshaling extracted value to JSON")
+	}
+
+	return string(payload[:]), nil
+}
+
+func (jf *JSONFilters) List() ([]*JSONFilter) {
+	jf.RLock()
+	defer jf.RUnlock()
+
+	filters := make([]*JSONFilter, 0)
+
+	for _, f := range jf.filters {
+		filter := &JSONFilter{}
+		*filter = *f
+
+		filters = append(filters, filter)
+	}
+
+	return filters
+}
+
+func (jf *JSONFilters) Add(name, path string) (error) {
+	jf.Lock()
+	defer jf.Unlock()
+
+	if _, found := jf.filters[name]; found {
+		return errors.Errorf("JSON filter %s is already declared", name)
+	}
+
+	f := &JSONFilter{
+		Name: name,
+		Path: path,
+	}
+
+	err := parseJSONFilter(f)
+	if err != nil {
+		return errors.Wrapf(err, "Error parsing JSON filter %s", name)
+	}
+
+	jf.filters[name] = f
+
+	return nil
+}
+
+func (jf *JSONFilters) Get(name string) (string, bool) {
+	jf.RLock()
+	defer jf.RUnlock()
+
+	if f, found := jf.filters[name]; found {
+		return f.Path, true
+	}
+
+	return "", false
+}
+
+func (jf *JSONFilters) Delete(name string) (error) {
+	jf.Lock()
+	defer jf.Unlock()
+
+	if _, found := jf.filters[name]; found {
+		delete(jf.filters, name)
+		return nil
+	}
+
+	return errors.Errorf("JSON filter %s has not been found", name)
+}
+
+func (jf *JSONFilters) ExportConfig() ([]byte, error) {
+	jf.RLock()
+	defer jf.RUnlock()
+
+	exports := make(map[string]string)
+
+	for name, f := range jf.filters {
+		exports[name] = f.Path
+	}
+
+	payload, err := json.MarshalIndent(exports, "", "	")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling JSON filters to JSON")
+	}
+
+	return payload, nil
+}
+
+func (jf *JSONFilters) ImportConfig(payload []byte) (error) {
+	exports := make(map[string]string)
+	jsonFilters := NewJSONFilters()
+
+	err := json.Unmarshal(payload, &exports)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshaling JSON filters from JSON")
+	}
+
+	for name, path := range exports {
+		err := jsonFilters.Add(name, path)
+		if err != nil {
+			return errors.Wrapf(err, "Error processing JSON filter %s", name)
+		}
+	}
+
+	jf.Lock()
+	defer jf.Unlock()
+
+	jf.filters = jsonFilters.filters
+
+	return nil
+}
+
+func NewJSONFilters() (*JSONFilters) {
+	return &JSONFilters{
+		filters: make(map[string]*JSONFilter),
+	}
+}
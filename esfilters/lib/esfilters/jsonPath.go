@@ -0,0 +1,207 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"strconv"
+	"strings"
+	"sort"
+)
+
+// Small subset of JSONPath:
+//   - optional root: $
+//   - child: .name or ['name'] or ["name"]
+//   - index: [0], negative indexes start from the end: [-1]
+//   - wildcard: .* or [*] on both objects and arrays
+//
+// A path without the root is a dotted path: fields.env is the same as $.fields.env
+type JSONPath struct {
+	path string
+	steps []*jsonPathStep
+	wildcard bool
+}
+
+type jsonPathStepType int
+
+const (
+	jsonPathStepKey jsonPathStepType = iota
+	jsonPathStepIndex
+	jsonPathStepWildcard
+)
+
+type jsonPathStep struct {
+	t jsonPathStepType
+	key string
+	index int
+}
+
+var (
+	ErrJSONPathInvalid error = errors.New("invalid JSON path")
+	ErrJSONPathNotFound error = errors.New("JSON path not found")
+)
+
+func ParseJSONPath(path string) (*JSONPath, error) {
+	jp := &JSONPath{
+		path: path,
+		steps: make([]*jsonPathStep, 0),
+	}
+
+	if path == "" {
+		return nil, errors.Wrap(ErrJSONPathInvalid, "Path is empty")
+	}
+
+	// Positions in errors are relative to path, not p
+	p := path
+	offset := 1
+
+	if strings.HasPrefix(p, "$") {
+		p = p[1:]
+	} else {
+		p = "." + p
+		offset = -1
+	}
+
+	for i := 0; i < len(p); {
+		switch p[i] {
+			case '.':
+				i++
+				if i < len(p) && p[i] == '*' {
+					jp.steps = append(jp.steps, &jsonPathStep{t: jsonPathStepWildcard,})
+					jp.wildcard = true
+					i++
+					continue
+				}
+
+				start := i
+				for i < len(p) && p[i] != '.' && p[i] != '[' {
+					i++
+				}
+
+				if start == i {
+					return nil, errors.Wrapf(ErrJSONPathInvalid, "Empty key at position %d in %q", start + offset, path)
+				}
+
+				jp.steps = append(jp.steps, &jsonPathStep{t: jsonPathStepKey, key: p[start:i],})
+			case '[':
+				end := strings.IndexByte(p[i:], ']')
+				if end == -1 {
+					return nil, errors.Wrapf(ErrJSONPathInvalid, "Missing ] at position %d in %q", i + offset, path)
+				}
+
+				inner := strings.TrimSpace(p[i + 1:i + end])
+
+				step, err := parseJSONPathBracket(inner)
+				if err != nil {
+					return nil, errors.Wrapf(err, "Bad selector at position %d in %q", i + offset, path)
+				}
+
+				if step.t == jsonPathStepWildcard {
+					jp.wildcard = true
+				}
+
+				jp.steps = append(jp.steps, step)
+				i += end + 1
+			default:
+				return nil, errors.Wrapf(ErrJSONPathInvalid, "Unexpected %q at position %d in %q", p[i], i + offset, path)
+		}
+	}
+
+	return jp, nil
+}
+
+func parseJSONPathBracket(inner string) (*jsonPathStep, error) {
+	if inner == "*" {
+		return &jsonPathStep{t: jsonPathStepWildcard,}, nil
+	}
+
+	if l := len(inner); l >= 2 {
+		if (inner[0] == '\'' && inner[l - 1] == '\'') || (inner[0] == '"' && inner[l - 1] == '"') {
+			return &jsonPathStep{t: jsonPathStepKey, key: inner[1:l - 1],}, nil
+		}
+	}
+
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return nil, errors.Wrapf(ErrJSONPathInvalid, "Selector %q is neither a quoted key, an index nor *", inner)
+	}
+
+	return &jsonPathStep{t: jsonPathStepIndex, index: index,}, nil
+}
+
+func (jp JSONPath) String() (string) {
+	return jp.path
+}
+
+// Extract the value from v which is the result of json.Unmarshal.
+// When the path has a wildcard, all the matches are returned as a []interface{}.
+func (jp JSONPath) Extract(v interface{}) (interface{}, error) {
+	values := []interface{}{v,}
+
+	for _, step := range jp.steps {
+		next := make([]interface{}, 0)
+
+		for _, value := range values {
+			next = append(next, step.apply(value)...)
+		}
+
+		values = next
+	}
+
+	if jp.wildcard {
+		return values, nil
+	}
+
+	if len(values) == 0 {
+		return nil, errors.Wrapf(ErrJSONPathNotFound, "Path %s", jp.path)
+	}
+
+	return values[0], nil
+}
+
+func (s jsonPathStep) apply(v interface{}) ([]interface{}) {
+	switch s.t {
+		case jsonPathStepKey:
+			if m, ok := v.(map[string]interface{}); ok {
+				if value, found := m[s.key]; found {
+					return []interface{}{value,}
+				}
+			}
+		case jsonPathStepIndex:
+			if a, ok := v.([]interface{}); ok {
+				index := s.index
+				if index < 0 {
+					index += len(a)
+				}
+
+				if index >= 0 && index < len(a) {
+					return []interface{}{a[index],}
+				}
+			}
+		case jsonPathStepWildcard:
+			switch value := v.(type) {
+				case []interface{}:
+					return value
+				case map[string]interface{}:
+					values := make([]interface{}, 0, len(value))
+					for _, key := range sortedKeys(value) {
+						values = append(values, value[key])
+					}
+
+					return values
+			}
+	}
+
+	return nil
+}
+
+// Wildcards on objects return values ordered by key so the output is stable
+func sortedKeys(m map[string]interface{}) ([]string) {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
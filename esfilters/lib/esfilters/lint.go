@@ -0,0 +1,208 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"strings"
+	"sort"
+)
+
+type FilterLintError struct {
+	Name string
+	Query string
+	File string
+	Err error
+}
+
+func (e FilterLintError) Error() (string) {
+	if e.File != "" {
+		return errors.Wrapf(e.Err, "Filter %s from %s", e.Name, e.File).Error()
+	}
+
+	return errors.Wrapf(e.Err, "Filter %s", e.Name).Error()
+}
+
+// Check every filter of the configuration without stopping at the first
+// broken one, ImportConfig would fail before anything can be reported.
+func LintConfig(data []byte) ([]*FilterLintError, error) {
+	raw := &ConfigRaw{}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling data to JSON")
+	}
+
+	if raw.Filters == nil {
+		return make([]*FilterLintError, 0), nil
+	}
+
+	return LintQueryFiltersConfig([]byte(*raw.Filters))
+}
+
+// Lint the filters of every layer as ImportConfigFromFiles merges them
+func LintConfigFiles(files ...string) ([]*FilterLintError, error) {
+	loader := newConfigLoader()
+
+	for _, file := range files {
+		err := loader.loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merged := make(map[string]json.RawMessage)
+	origins := make(map[string]string)
+
+	for _, layer := range loader.layers {
+		for name, value := range layer.values[ConfigSectionFilters] {
+			merged[name] = value
+			origins[name] = layer.file
+		}
+	}
+
+	payload, err := json.Marshal(merged)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling filters to JSON")
+	}
+
+	lintErrors, err := LintQueryFiltersConfig(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(loader.layers) > 1 {
+		for _, lintError := range lintErrors {
+			lintError.File = origins[lintError.Name]
+		}
+	}
+
+	return lintErrors, nil
+}
+
+func LintQueryFiltersConfig(payload []byte) ([]*FilterLintError, error) {
+	objects := make(map[string]*QueryFilterExport)
+
+	err := json.Unmarshal(payload, &objects)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling filters from JSON")
+	}
+
+	exports := queryFilterExportsQueries(objects)
+
+	names := make([]string, 0, len(exports))
+	for name := range exports {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	lintErrors := make([]*FilterLintError, 0)
+
+	for _, name := range names {
+		query := exports[name]
+
+		var err error
+
+		if objects[name] != nil && objects[name].DSL != nil {
+			err = lintDSLFilter(objects, name)
+		} else {
+			err = lintQueryFilter(objects, name, query)
+		}
+		if err != nil {
+			lintErrors = append(lintErrors, &FilterLintError{
+				Name: name,
+				Query: query,
+				Err: err,
+			})
+		}
+	}
+
+	if len(lintErrors) != 0 {
+		return lintErrors, nil
+	}
+
+	// Every filter is fine on its own, importing catches the rest
+	err = NewQueryFilters().ImportConfig(payload)
+	if err != nil {
+		lintErrors = append(lintErrors, &FilterLintError{
+			Err: err,
+		})
+	}
+
+	return lintErrors, nil
+}
+
+func lintQueryFilter(exports map[string]*QueryFilterExport, name, query string) (error) {
+	if ok := QueryRegexpName.MatchString(name); ! ok {
+		return errors.Errorf("Invalid name %s", name)
+	}
+
+	err := validateFilterQuery(query)
+	if err != nil {
+		return err
+	}
+
+	for _, loc := range QueryRegexp.FindAllStringSubmatchIndex(query, -1) {
+		split := strings.Split(query[loc[2]:loc[3]], ":")
+
+		switch split[0] {
+			case "filter":
+				export, found := exports[split[1]]
+				if ! found {
+					return newQueryStringError(query, loc[0], "filter %s has not been found", split[1])
+				}
+
+				if export != nil && export.DSL != nil {
+					return newQueryStringError(query, loc[0], "filter %s is a DSL filter, it can only be referenced by DSL filters", split[1])
+				}
+			case "placeholder":
+			default:
+				return newQueryStringError(query, loc[0], "filter type %s is not yet implemented", split[0])
+		}
+	}
+
+	return nil
+}
+
+func lintDSLFilter(exports map[string]*QueryFilterExport, name string) (error) {
+	if ok := QueryRegexpName.MatchString(name); ! ok {
+		return errors.Errorf("Invalid name %s", name)
+	}
+
+	if exports[name].Query != "" {
+		return errors.New("Filter cannot have both a query and a dsl")
+	}
+
+	dsl, err := decodeDSL(exports[name].DSL)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := dsl.(map[string]interface{}); ! ok {
+		return errors.New("DSL has to be a JSON object")
+	}
+
+	_, err = walkDSL(dsl, func(str string) (interface{}, error) {
+		for _, loc := range QueryRegexp.FindAllStringSubmatchIndex(str, -1) {
+			split := strings.Split(str[loc[2]:loc[3]], ":")
+
+			switch split[0] {
+				case "filter":
+					if loc[0] != 0 || loc[1] != len(str) {
+						return nil, errors.Errorf("Filter %s has to be the whole string to be used in a DSL", split[1])
+					}
+
+					if _, found := exports[split[1]]; ! found {
+						return nil, errors.Errorf("Filter %s has not been found", split[1])
+					}
+				case "placeholder":
+				default:
+					return nil, errors.Errorf("Filter type %s is not yet implemented", split[0])
+			}
+		}
+
+		return str, nil
+	})
+
+	return err
+}
@@ -2,14 +2,25 @@ package esfilters
 
 import (
 	"github.com/tehmoon/errors"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
 
+// A filter is either a query_string Query or a query DSL fragment.
+// For DSL filters ParsedQuery is the fragment as JSON with every
+// referenced filter inlined.
 type QueryFilter struct {
 	Name string
 	Query string
+	DSL json.RawMessage
 	ParsedQuery string
+	Dependencies []string
+	QueryFilterMetadata
+}
+
+func (q QueryFilter) IsDSL() (bool) {
+	return q.DSL != nil
 }
 
 func parseQuery(qf map[string]*QueryFilter, q *QueryFilter) (map[string][]string, error) {
@@ -17,6 +28,11 @@ func parseQuery(qf map[string]*QueryFilter, q *QueryFilter) (map[string][]string
 		return nil, errors.Errorf("Invalid name %s", q.Name)
 	}
 
+	err := validateFilterQuery(q.Query)
+	if err != nil {
+		return nil, err
+	}
+
 	dependsOn := make(map[string][]string)
 
 	parsedQuery, err := resolveQuery(qf, q.Query, dependsOn)
@@ -29,6 +45,15 @@ func parseQuery(qf map[string]*QueryFilter, q *QueryFilter) (map[string][]string
 	return dependsOn, nil
 }
 
+// Like ValidateQueryString but a filter cannot be empty
+func validateFilterQuery(query string) (error) {
+	if strings.TrimSpace(query) == "" {
+		return newQueryStringError(query, 0, "query is empty")
+	}
+
+	return ValidateQueryString(query)
+}
+
 func resolveQuery(qf map[string]*QueryFilter, q string, dependsOn map[string][]string) (string, error) {
 	query := fmt.Sprintf("(%s)", q)
 	parsedQuery := QueryRegexp.ReplaceAllStringFunc(query, QueryRegexpFunc(qf, dependsOn))
@@ -41,9 +66,22 @@ func resolveQuery(qf map[string]*QueryFilter, q string, dependsOn map[string][]s
 	return parsedQuery, nil
 }
 
+func resolvePlaceholders(query string, placeholders map[string]string) (string, error) {
+	parsedQuery := QueryRegexp.ReplaceAllStringFunc(query, QueryRegexpPlaceholderFunc(placeholders))
+
+	err := parsedQueryHasErrors(parsedQuery)
+	if err != nil {
+		return "", err
+	}
+
+	return parsedQuery, nil
+}
+
 var (
 	ErrQueryFilterValueNotFound error
 	ErrQueryFilterTypeNotFound error
+	ErrQueryFilterPlaceholderNotFound error = errors.New("placeholder not found")
+	ErrQueryFilterDSL error = errors.New("DSL filter in a query string")
 )
 
 func parsedQueryHasErrors(query string) (error) {
@@ -59,6 +97,12 @@ func parsedQueryHasErrors(query string) (error) {
 				return errors.Wrapf(ErrQueryFilterValueNotFound, "Filter value %s has not been found", partTarget)
 			case "type_not_found":
 				return errors.Wrapf(ErrQueryFilterTypeNotFound, "Filter type %s is not yet implemented", partTarget)
+			case "aggregation_not_found":
+				return errors.Wrapf(ErrAggregationFilterValueNotFound, "Aggregation %s has not been found", partTarget)
+			case "placeholder_not_found":
+				return errors.Wrapf(ErrQueryFilterPlaceholderNotFound, "Placeholder %s has no value and no default", partTarget)
+			case "dsl_filter":
+				return errors.Wrapf(ErrQueryFilterDSL, "Filter %s is a DSL filter, it can only be referenced by DSL filters", partTarget)
 		}
 
 		return errors.Errorf("unknown error %s: %s", partErr, partTarget)
@@ -66,3 +110,34 @@ func parsedQueryHasErrors(query string) (error) {
 
 	return nil
 }
+
+// Optional information about a filter, Index is the
+// index to query when the filter is used without one.
+type QueryFilterMetadata struct {
+	Description string `json:"description,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Index string `json:"index,omitempty"`
+}
+
+func (m QueryFilterMetadata) IsZero() (bool) {
+	return m.Description == "" && len(m.Tags) == 0 && m.Owner == "" && m.Index == ""
+}
+
+func (m QueryFilterMetadata) HasTag(tag string) (bool) {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m QueryFilterMetadata) copy() (QueryFilterMetadata) {
+	if m.Tags != nil {
+		m.Tags = append([]string{}, m.Tags...)
+	}
+
+	return m
+}
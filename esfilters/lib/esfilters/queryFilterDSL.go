@@ -0,0 +1,213 @@
+package esfilters
+
+import (
+	"gopkg.in/olivere/elastic.v5"
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"strings"
+	"bytes"
+)
+
+// DSL fragments reference other filters with a string made only of
+// %{filter:name}, it is replaced by the filter's DSL. query_string filters
+// become {"query_string": {"query": ...}}. Placeholders can be used inside
+// any string and are resolved by Compile.
+func parseDSL(qf map[string]*QueryFilter, q *QueryFilter) (map[string][]string, error) {
+	if ok := QueryRegexpName.MatchString(q.Name); ! ok {
+		return nil, errors.Errorf("Invalid name %s", q.Name)
+	}
+
+	dsl, err := decodeDSL(q.DSL)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := dsl.(map[string]interface{}); ! ok {
+		return nil, errors.New("DSL has to be a JSON object")
+	}
+
+	dependsOn := make(map[string][]string)
+
+	resolved, err := walkDSL(dsl, func(str string) (interface{}, error) {
+		return resolveDSLString(qf, str, dependsOn)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(resolved)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling DSL to JSON")
+	}
+
+	q.ParsedQuery = string(payload)
+
+	return dependsOn, nil
+}
+
+func decodeDSL(data []byte) (interface{}, error) {
+	var dsl interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&dsl)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling DSL from JSON")
+	}
+
+	return dsl, nil
+}
+
+// Call fn on every string value of the DSL, keys are left untouched
+func walkDSL(dsl interface{}, fn func(string) (interface{}, error)) (interface{}, error) {
+	switch v := dsl.(type) {
+		case map[string]interface{}:
+			object := make(map[string]interface{})
+
+			for key, value := range v {
+				value, err := walkDSL(value, fn)
+				if err != nil {
+					return nil, err
+				}
+
+				object[key] = value
+			}
+
+			return object, nil
+		case []interface{}:
+			array := make([]interface{}, 0, len(v))
+
+			for _, value := range v {
+				value, err := walkDSL(value, fn)
+				if err != nil {
+					return nil, err
+				}
+
+				array = append(array, value)
+			}
+
+			return array, nil
+		case string:
+			return fn(v)
+	}
+
+	return dsl, nil
+}
+
+func resolveDSLString(qf map[string]*QueryFilter, str string, dependsOn map[string][]string) (interface{}, error) {
+	for _, loc := range QueryRegexp.FindAllStringSubmatchIndex(str, -1) {
+		split := strings.Split(str[loc[2]:loc[3]], ":")
+
+		switch split[0] {
+			case "placeholder":
+				dependsOn["placeholder"] = appendUniq(dependsOn["placeholder"], split[1])
+				continue
+			case "filter":
+			default:
+				return nil, errors.Wrapf(ErrQueryFilterTypeNotFound, "Filter type %s is not yet implemented", split[0])
+		}
+
+		if loc[0] != 0 || loc[1] != len(str) {
+			return nil, errors.Errorf("Filter %s has to be the whole string to be used in a DSL", split[1])
+		}
+
+		f, found := qf[split[1]]
+		if ! found {
+			return nil, errors.Wrapf(ErrQueryFilterValueNotFound, "Filter value %s has not been found", split[1])
+		}
+
+		dependsOn["filter"] = appendUniq(dependsOn["filter"], split[1])
+
+		return f.dsl()
+	}
+
+	return str, nil
+}
+
+func appendUniq(values []string, value string) ([]string) {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+// The filter as a DSL value, with its placeholders still unresolved
+func (q QueryFilter) dsl() (interface{}, error) {
+	if q.IsDSL() {
+		return decodeDSL([]byte(q.ParsedQuery))
+	}
+
+	return map[string]interface{}{
+		"query_string": map[string]interface{}{
+			"query": q.ParsedQuery,
+		},
+	}, nil
+}
+
+// Replace the placeholders of every string of the DSL
+func resolveDSLPlaceholders(parsedQuery string, placeholders map[string]string) (string, error) {
+	dsl, err := decodeDSL([]byte(parsedQuery))
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := walkDSL(dsl, func(str string) (interface{}, error) {
+		return resolvePlaceholders(str, placeholders)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(resolved)
+	if err != nil {
+		return "", errors.Wrap(err, "Error marshaling DSL to JSON")
+	}
+
+	return string(payload), nil
+}
+
+// Compile the filters into a single query. DSL filters go in the bool
+// filter clauses so they are cached and do not score, query_string
+// filters go in the must clauses.
+func (qf *QueryFilters) Compile(names []string, placeholders map[string]string) (elastic.Query, error) {
+	qf.RLock()
+	defer qf.RUnlock()
+
+	values := qf.placeholderValues(placeholders)
+	query := elastic.NewBoolQuery()
+
+	for _, name := range names {
+		f, found := qf.filters[name]
+		if ! found {
+			return nil, errors.Wrapf(ErrQueryFilterValueNotFound, "Filter value %s has not been found", name)
+		}
+
+		if f.IsDSL() {
+			dsl, err := resolveDSLPlaceholders(f.ParsedQuery, values)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error resolving filter %s", name)
+			}
+
+			query = query.Filter(elastic.NewRawStringQuery(dsl))
+			continue
+		}
+
+		parsedQuery, err := resolvePlaceholders(f.ParsedQuery, values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error resolving filter %s", name)
+		}
+
+		err = ValidateQueryString(parsedQuery)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Resolved query %s is invalid, check the placeholder's values", parsedQuery)
+		}
+
+		query = query.Must(elastic.NewQueryStringQuery(parsedQuery))
+	}
+
+	return query, nil
+}
@@ -0,0 +1,130 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"strings"
+	"sort"
+)
+
+var ErrQueryFilterCycle error = errors.New("recursive filters")
+
+// Dependency graph of the filters, edges go from a filter
+// to the filters it references with %{filter:name}.
+type QueryFilterGraph struct {
+	edges map[string][]string
+}
+
+// Build the graph straight from the exported queries so it works
+// even when the filters cannot be parsed yet.
+func NewQueryFilterGraph(exports map[string]string) (*QueryFilterGraph) {
+	g := &QueryFilterGraph{
+		edges: make(map[string][]string),
+	}
+
+	for name, query := range exports {
+		g.edges[name] = queryFilterReferences(query)
+	}
+
+	return g
+}
+
+// Sorted and deduplicated names of the filters referenced by query
+func queryFilterReferences(query string) ([]string) {
+	return queryReferences(query, "filter")
+}
+
+// Same as queryFilterReferences for any %{partType:name} reference
+func queryReferences(query, partType string) ([]string) {
+	seen := make(map[string]bool)
+	references := make([]string, 0)
+
+	for _, part := range QueryRegexp.FindAllStringSubmatch(query, -1) {
+		split := strings.Split(part[1], ":")
+		if split[0] != partType || seen[split[1]] {
+			continue
+		}
+
+		seen[split[1]] = true
+		references = append(references, split[1])
+	}
+
+	sort.Strings(references)
+
+	return references
+}
+
+func (g QueryFilterGraph) names() ([]string) {
+	names := make([]string, 0, len(g.edges))
+
+	for name := range g.edges {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Order the filters so every filter comes after the filters it references.
+// References to unknown filters are ignored, Add reports them.
+// Returns an error naming the exact cycle: a -> b -> a
+func (g QueryFilterGraph) Sort() ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	order := make([]string, 0, len(g.edges))
+	stack := make([]string, 0)
+
+	var visit func(string) (error)
+	visit = func(name string) (error) {
+		switch state[name] {
+			case visited:
+				return nil
+			case visiting:
+				start := 0
+				for i, n := range stack {
+					if n == name {
+						start = i
+						break
+					}
+				}
+
+				cycle := append(append([]string{}, stack[start:]...), name)
+
+				return errors.Wrapf(ErrQueryFilterCycle, "Filters form a cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, dependency := range g.edges[name] {
+			if _, found := g.edges[dependency]; ! found {
+				continue
+			}
+
+			err := visit(dependency)
+			if err != nil {
+				return err
+			}
+		}
+
+		stack = stack[:len(stack) - 1]
+		state[name] = visited
+		order = append(order, name)
+
+		return nil
+	}
+
+	for _, name := range g.names() {
+		err := visit(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
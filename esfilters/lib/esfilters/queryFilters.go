@@ -3,33 +3,164 @@ package esfilters
 import (
 	"github.com/tehmoon/errors"
 	"encoding/json"
+	"fmt"
 	"strings"
+	"sort"
 	"sync"
 )
 
+// Safe for concurrent use, the readers share the lock
+// and every change replaces the filters under the write lock.
 type QueryFilters struct {
 	sync.RWMutex
 	filters map[string]*QueryFilter
 	dependencies map[string][]string
-	exports map[string]string
+	exports map[string]*QueryFilterExport
+	placeholders map[string]string
 }
 
-func (qf QueryFilters) Resolve(query string) (string, error) {
+// Resolve the query using only the default placeholders
+func (qf *QueryFilters) Resolve(query string) (string, error) {
+	return qf.ResolvePlaceholders(query, nil)
+}
+
+// Resolve the query then replace every %{placeholder:name} with
+// its value from placeholders, falling back to the defaults.
+// An empty or blank query matches every document, it resolves to *.
+func (qf *QueryFilters) ResolvePlaceholders(query string, placeholders map[string]string) (string, error) {
+	if strings.TrimSpace(query) == "" {
+		return "*", nil
+	}
+
+	qf.RLock()
+	defer qf.RUnlock()
+
+	err := ValidateQueryString(query)
+	if err != nil {
+		return "", err
+	}
+
+	parsedQuery, err := resolveQuery(qf.filters, query, nil)
+	if err != nil {
+		return "", err
+	}
+
+	parsedQuery, err = resolvePlaceholders(parsedQuery, qf.placeholderValues(placeholders))
+	if err != nil {
+		return "", err
+	}
+
+	// Only placeholder's values can break the syntax at this point
+	err = ValidateQueryString(parsedQuery)
+	if err != nil {
+		return "", errors.Wrapf(err, "Resolved query %s is invalid, check the placeholder's values", parsedQuery)
+	}
+
+	return parsedQuery, nil
+}
+
+// Default placeholders overridden by placeholders
+func (qf *QueryFilters) placeholderValues(placeholders map[string]string) (map[string]string) {
+	values := make(map[string]string)
+	for name, value := range qf.placeholders {
+		values[name] = value
+	}
+
+	for name, value := range placeholders {
+		values[name] = value
+	}
+
+	return values
+}
+
+func (qf *QueryFilters) AddPlaceholder(name, value string) (error) {
 	qf.Lock()
 	defer qf.Unlock()
 
-	return resolveQuery(qf.filters, query, nil)
+	if ok := QueryRegexpName.MatchString(name); ! ok {
+		return errors.Errorf("Invalid placeholder name %s", name)
+	}
+
+	qf.placeholders[name] = value
+
+	return nil
 }
 
-func (qf QueryFilters) List() ([]*QueryFilter) {
+func (qf *QueryFilters) DeletePlaceholder(name string) (error) {
 	qf.Lock()
 	defer qf.Unlock()
 
+	if _, found := qf.placeholders[name]; ! found {
+		return errors.Errorf("Placeholder %s has not been found", name)
+	}
+
+	delete(qf.placeholders, name)
+
+	return nil
+}
+
+func (qf *QueryFilters) ListPlaceholders() (map[string]string) {
+	qf.RLock()
+	defer qf.RUnlock()
+
+	placeholders := make(map[string]string)
+
+	for name, value := range qf.placeholders {
+		placeholders[name] = value
+	}
+
+	return placeholders
+}
+
+func (qf *QueryFilters) ExportPlaceholdersConfig() ([]byte, error) {
+	qf.RLock()
+	defer qf.RUnlock()
+
+	payload, err := json.MarshalIndent(qf.placeholders, "", "	")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshaling placeholders to JSON")
+	}
+
+	return payload, nil
+}
+
+// Replace every placeholder, nothing is changed if one of them is invalid
+func (qf *QueryFilters) ImportPlaceholdersConfig(payload []byte) (error) {
+	placeholders := make(map[string]string)
+
+	err := json.Unmarshal(payload, &placeholders)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshaling placeholders from JSON")
+	}
+
+	if placeholders == nil {
+		placeholders = make(map[string]string)
+	}
+
+	for name := range placeholders {
+		if ok := QueryRegexpName.MatchString(name); ! ok {
+			return errors.Errorf("Error processing placeholder %s: invalid placeholder name", name)
+		}
+	}
+
+	qf.Lock()
+	defer qf.Unlock()
+
+	qf.placeholders = placeholders
+
+	return nil
+}
+
+func (qf *QueryFilters) List() ([]*QueryFilter) {
+	qf.RLock()
+	defer qf.RUnlock()
+
 	filters := make([]*QueryFilter, 0)
 
 	for _, f := range qf.filters {
 		filter := &QueryFilter{}
 		*filter = *f
+		filter.QueryFilterMetadata = f.QueryFilterMetadata.copy()
 
 		filters = append(filters, filter)
 	}
@@ -37,25 +168,55 @@ func (qf QueryFilters) List() ([]*QueryFilter) {
 	return filters
 }
 
-func (qf QueryFilters) Add(name, query string) (error) {
-	qf.RLock()
-	defer qf.RUnlock()
+func (qf *QueryFilters) Add(name, query string) (error) {
+	return qf.add(name, &QueryFilterExport{
+		Query: query,
+	})
+}
+
+// Add a filter made of an elasticsearch query DSL fragment
+func (qf *QueryFilters) AddDSL(name string, dsl json.RawMessage) (error) {
+	return qf.add(name, &QueryFilterExport{
+		DSL: dsl,
+	})
+}
+
+func (qf *QueryFilters) add(name string, export *QueryFilterExport) (error) {
+	qf.Lock()
+	defer qf.Unlock()
 
 	if _, found := qf.filters[name]; found {
 		return errors.Errorf("Query %s is already declared", name)
 	}
 
+	if export.Query != "" && export.DSL != nil {
+		return errors.Errorf("Filter %s cannot have both a query and a dsl", name)
+	}
+
 	q := &QueryFilter{
 		Name: name,
-		Query: query,
+		Query: export.Query,
+		DSL: export.DSL,
+		QueryFilterMetadata: export.QueryFilterMetadata.copy(),
 	}
 
-	dependsOn, err := parseQuery(qf.filters, q)
+	var (
+		dependsOn map[string][]string
+		err error
+	)
+
+	if q.IsDSL() {
+		dependsOn, err = parseDSL(qf.filters, q)
+	} else {
+		dependsOn, err = parseQuery(qf.filters, q)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "Error parsing query %s", q.Name)
 	}
 
 	if values, found := dependsOn["filter"]; found {
+		q.Dependencies = values
+
 		for _, value := range values {
 			dependencies, found := qf.dependencies[value]
 			if ! found {
@@ -77,14 +238,14 @@ func (qf QueryFilters) Add(name, query string) (error) {
 	}
 
 	qf.filters[name] = q
-	qf.exports[name] = query
+	qf.exports[name] = export.copy()
 
 	return nil
 }
 
-func (qf QueryFilters) Get(name string) (string, bool) {
-	qf.Lock()
-	defer qf.Unlock()
+func (qf *QueryFilters) Get(name string) (string, bool) {
+	qf.RLock()
+	defer qf.RUnlock()
 
 	if f, found := qf.filters[name]; found {
 		return f.ParsedQuery, true
@@ -93,7 +254,73 @@ func (qf QueryFilters) Get(name string) (string, bool) {
 	return "", false
 }
 
-func (qf QueryFilters) ExportConfig() ([]byte, error) {
+// Copy of the filter name with its metadata
+func (qf *QueryFilters) Filter(name string) (*QueryFilter, bool) {
+	qf.RLock()
+	defer qf.RUnlock()
+
+	f, found := qf.filters[name]
+	if ! found {
+		return nil, false
+	}
+
+	filter := &QueryFilter{}
+	*filter = *f
+	filter.QueryFilterMetadata = f.QueryFilterMetadata.copy()
+
+	return filter, true
+}
+
+// Replace the metadata of the filter name
+func (qf *QueryFilters) SetMetadata(name string, metadata QueryFilterMetadata) (error) {
+	qf.Lock()
+	defer qf.Unlock()
+
+	f, found := qf.filters[name]
+	if ! found {
+		return errors.Errorf("Filter %s has not been found", name)
+	}
+
+	f.QueryFilterMetadata = metadata.copy()
+	qf.exports[name].QueryFilterMetadata = metadata.copy()
+
+	return nil
+}
+
+// Filters directly referenced by the filter name
+func (qf *QueryFilters) Dependencies(name string) ([]string, bool) {
+	qf.RLock()
+	defer qf.RUnlock()
+
+	f, found := qf.filters[name]
+	if ! found {
+		return nil, false
+	}
+
+	dependencies := make([]string, len(f.Dependencies))
+	copy(dependencies, f.Dependencies)
+	sort.Strings(dependencies)
+
+	return dependencies, true
+}
+
+// Filters directly referencing the filter name
+func (qf *QueryFilters) Dependents(name string) ([]string, bool) {
+	qf.RLock()
+	defer qf.RUnlock()
+
+	if _, found := qf.filters[name]; ! found {
+		return nil, false
+	}
+
+	dependents := make([]string, len(qf.dependencies[name]))
+	copy(dependents, qf.dependencies[name])
+	sort.Strings(dependents)
+
+	return dependents, true
+}
+
+func (qf *QueryFilters) ExportConfig() ([]byte, error) {
 	qf.RLock()
 	defer qf.RUnlock()
 
@@ -105,17 +332,31 @@ func (qf QueryFilters) ExportConfig() ([]byte, error) {
 	return payload, nil
 }
 
-func (qf QueryFilters) Delete(name string) (error) {
-	qf.RLock()
-	defer qf.RUnlock()
+func (qf *QueryFilters) Delete(name string) (error) {
+	qf.Lock()
+	defer qf.Unlock()
 
 	if _, found := qf.filters[name]; found {
 		dependencies, _ := qf.dependencies[name]
 
-		if dependencies != nil {
+		if len(dependencies) != 0 {
 			return errors.Errorf("Filter %s has dependencies: %s", name, strings.Join(dependencies, ", "))
 		}
 
+		// The filters referenced by name are no longer needed by it
+		for _, dependency := range qf.filters[name].Dependencies {
+			dependents := make([]string, 0)
+
+			for _, dependent := range qf.dependencies[dependency] {
+				if dependent != name {
+					dependents = append(dependents, dependent)
+				}
+			}
+
+			qf.dependencies[dependency] = dependents
+		}
+
+		delete(qf.dependencies, name)
 		delete(qf.filters, name)
 		delete(qf.exports, name)
 		return nil
@@ -124,45 +365,103 @@ func (qf QueryFilters) Delete(name string) (error) {
 	return errors.Errorf("Filter %s has not been found", name)
 }
 
+// Replace every filter, the filters are parsed before
+// taking the lock so readers are not blocked meanwhile.
 func (qf *QueryFilters) ImportConfig(payload []byte) (error) {
-	qf.RLock()
-	defer qf.RUnlock()
-
-	exports := make(map[string]string)
-	queryFilters := NewQueryFilters()
+	exports := make(map[string]*QueryFilterExport)
 
 	err := json.Unmarshal(payload, &exports)
 	if err != nil {
 		return errors.Wrap(err, "Error unmarshaling filters from JSON")
 	}
 
-	var lastError error
+	queryFilters, err := newQueryFiltersFromExports(exports)
+	if err != nil {
+		return err
+	}
 
-	for {
-		length := len(exports)
-		if length == 0 {
-			break
-		}
+	qf.Lock()
+	defer qf.Unlock()
 
-		for name, query := range exports {
-			err := queryFilters.Add(name, query)
-			if err != nil {
-				if err, ok := err.(*errors.Error); ok {
-					if err.Root() == ErrQueryFilterValueNotFound {
-						lastError = err
-						continue
-					}
-				}
+	qf.filters = queryFilters.filters
+	qf.exports = queryFilters.exports
+	qf.dependencies = queryFilters.dependencies
 
-				return errors.Wrapf(err, "Error processing filter %s", name)
-			}
+	return nil
+}
 
-			delete(exports, name)
-		}
+// Replace the query of the filter name. Every filter depending on it is
+// parsed again, nothing is changed if one of them breaks.
+func (qf *QueryFilters) Update(name, query string) (error) {
+	return qf.update(name, query, nil)
+}
+
+// Same as Update with a query DSL fragment
+func (qf *QueryFilters) UpdateDSL(name string, dsl json.RawMessage) (error) {
+	return qf.update(name, "", dsl)
+}
+
+func (qf *QueryFilters) update(name, query string, dsl json.RawMessage) (error) {
+	qf.Lock()
+	defer qf.Unlock()
+
+	if _, found := qf.filters[name]; ! found {
+		return errors.Errorf("Filter %s has not been found", name)
+	}
+
+	exports := qf.copyExports()
+	exports[name].Query = query
+	exports[name].DSL = dsl
+
+	queryFilters, err := newQueryFiltersFromExports(exports)
+	if err != nil {
+		return errors.Wrapf(err, "Error updating filter %s, nothing has been changed", name)
+	}
+
+	qf.filters = queryFilters.filters
+	qf.exports = queryFilters.exports
+	qf.dependencies = queryFilters.dependencies
+
+	return nil
+}
+
+// Rename the filter and rewrite every %{filter:name} reference
+// in the filters depending on it.
+func (qf *QueryFilters) Rename(name, newName string) (error) {
+	qf.Lock()
+	defer qf.Unlock()
 
-		if l := len(exports); l == length {
-			return errors.Wrap(lastError, "No filter left to add due to a recursive error")
+	if _, found := qf.filters[name]; ! found {
+		return errors.Errorf("Filter %s has not been found", name)
+	}
+
+	if _, found := qf.filters[newName]; found {
+		return errors.Errorf("Query %s is already declared", newName)
+	}
+
+	if ok := QueryRegexpName.MatchString(newName); ! ok {
+		return errors.Errorf("Invalid name %s", newName)
+	}
+
+	exports := qf.copyExports()
+
+	for _, dependent := range qf.dependencies[name] {
+		export := exports[dependent]
+
+		if export.DSL != nil {
+			export.DSL = json.RawMessage(renameQueryFilterReference(string(export.DSL), name, newName))
+			continue
 		}
+
+		export.Query = renameQueryFilterReference(export.Query, name, newName)
+	}
+
+	exports[newName] = exports[name]
+	delete(exports, name)
+
+	queryFilters, err := newQueryFiltersFromExports(exports)
+	if err != nil {
+		return errors.Wrapf(err, "Error renaming filter %s to %s, nothing has been changed", name, newName)
 	}
 
 	qf.filters = queryFilters.filters
@@ -172,10 +471,56 @@ func (qf *QueryFilters) ImportConfig(payload []byte) (error) {
 	return nil
 }
 
+func renameQueryFilterReference(query, name, newName string) (string) {
+	return QueryRegexp.ReplaceAllStringFunc(query, func(str string) (string) {
+		part := QueryRegexp.FindStringSubmatch(str)
+
+		if part[1] == fmt.Sprintf("filter:%s", name) {
+			return fmt.Sprintf("%%{filter:%s}", newName)
+		}
+
+		return str
+	})
+}
+
+func (qf *QueryFilters) copyExports() (map[string]*QueryFilterExport) {
+	exports := make(map[string]*QueryFilterExport)
+
+	for name, export := range qf.exports {
+		exports[name] = export.copy()
+	}
+
+	return exports
+}
+
+// Add every filter after the filters it references
+func newQueryFiltersFromExports(exports map[string]*QueryFilterExport) (*QueryFilters, error) {
+	queryFilters := NewQueryFilters()
+
+	order, err := NewQueryFilterGraph(queryFilterExportsQueries(exports)).Sort()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range order {
+		if exports[name] == nil {
+			return nil, errors.Errorf("Filter %s is empty", name)
+		}
+
+		err := queryFilters.add(name, exports[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error processing filter %s", name)
+		}
+	}
+
+	return queryFilters, nil
+}
+
 func NewQueryFilters() (*QueryFilters) {
 	return &QueryFilters{
 		filters: make(map[string]*QueryFilter),
-		exports: make(map[string]string),
+		exports: make(map[string]*QueryFilterExport),
 		dependencies: make(map[string][]string),
+		placeholders: make(map[string]string),
 	}
 }
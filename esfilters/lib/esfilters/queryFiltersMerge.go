@@ -0,0 +1,185 @@
+package esfilters
+
+import (
+	"github.com/tehmoon/errors"
+	"strings"
+	"sort"
+)
+
+var ErrQueryFiltersMergeConflict error = errors.New("conflicting filters")
+
+// What to do when a merged filter or placeholder
+// already exists with a different value.
+const (
+	QueryFiltersMergeFail = "fail"
+	QueryFiltersMergeSkip = "skip"
+	QueryFiltersMergeOverwrite = "overwrite"
+)
+
+const (
+	QueryFiltersMergeAdded = "added"
+	QueryFiltersMergeSkipped = "skipped"
+	QueryFiltersMergeOverwritten = "overwritten"
+)
+
+// Action taken for every merged entry by name,
+// entries already having the same value are left out.
+type QueryFiltersMergeResult struct {
+	Filters map[string]string
+	Placeholders map[string]string
+}
+
+// New filters made of the filters names, every filter they reference
+// directly or not and the placeholders they use that have a default.
+func (qf *QueryFilters) Select(names []string) (*QueryFilters, error) {
+	qf.RLock()
+	defer qf.RUnlock()
+
+	exports := make(map[string]*QueryFilterExport)
+	placeholders := make(map[string]string)
+
+	var visit func(string) (error)
+	visit = func(name string) (error) {
+		if _, found := exports[name]; found {
+			return nil
+		}
+
+		f, found := qf.filters[name]
+		if ! found {
+			return errors.Errorf("Filter %s has not been found", name)
+		}
+
+		exports[name] = qf.exports[name].copy()
+
+		query := queryFilterExportsQueries(map[string]*QueryFilterExport{name: exports[name]})[name]
+		for _, placeholder := range queryReferences(query, "placeholder") {
+			if value, found := qf.placeholders[placeholder]; found {
+				placeholders[placeholder] = value
+			}
+		}
+
+		for _, dependency := range f.Dependencies {
+			err := visit(dependency)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	selected, err := newQueryFiltersFromExports(exports)
+	if err != nil {
+		return nil, err
+	}
+
+	selected.placeholders = placeholders
+
+	return selected, nil
+}
+
+// Merge the filters and placeholders of from, conflicts are handled
+// according to strategy. The merged filters go through the same
+// dependency-ordered Add loop as ImportConfig so the result is always
+// valid, nothing is changed otherwise.
+func (qf *QueryFilters) Merge(from *QueryFilters, strategy string) (*QueryFiltersMergeResult, error) {
+	switch strategy {
+		case QueryFiltersMergeFail, QueryFiltersMergeSkip, QueryFiltersMergeOverwrite:
+		default:
+			return nil, errors.Errorf("Unknown conflict strategy %s", strategy)
+	}
+
+	from.RLock()
+	incoming := from.copyExports()
+	incomingPlaceholders := from.placeholderValues(nil)
+	from.RUnlock()
+
+	qf.Lock()
+	defer qf.Unlock()
+
+	exports := qf.copyExports()
+	placeholders := qf.placeholderValues(nil)
+
+	result := &QueryFiltersMergeResult{
+		Filters: make(map[string]string),
+		Placeholders: make(map[string]string),
+	}
+
+	conflicts := make([]string, 0)
+
+	for name, export := range incoming {
+		current, found := exports[name]
+		if ! found {
+			exports[name] = export
+			result.Filters[name] = QueryFiltersMergeAdded
+			continue
+		}
+
+		same, err := current.equal(export)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error comparing filter %s", name)
+		}
+
+		if same {
+			continue
+		}
+
+		switch strategy {
+			case QueryFiltersMergeSkip:
+				result.Filters[name] = QueryFiltersMergeSkipped
+			case QueryFiltersMergeOverwrite:
+				exports[name] = export
+				result.Filters[name] = QueryFiltersMergeOverwritten
+			default:
+				conflicts = append(conflicts, "filter " + name)
+		}
+	}
+
+	for name, value := range incomingPlaceholders {
+		current, found := placeholders[name]
+		if ! found {
+			placeholders[name] = value
+			result.Placeholders[name] = QueryFiltersMergeAdded
+			continue
+		}
+
+		if current == value {
+			continue
+		}
+
+		switch strategy {
+			case QueryFiltersMergeSkip:
+				result.Placeholders[name] = QueryFiltersMergeSkipped
+			case QueryFiltersMergeOverwrite:
+				placeholders[name] = value
+				result.Placeholders[name] = QueryFiltersMergeOverwritten
+			default:
+				conflicts = append(conflicts, "placeholder " + name)
+		}
+	}
+
+	if len(conflicts) != 0 {
+		sort.Strings(conflicts)
+
+		return nil, errors.Wrapf(ErrQueryFiltersMergeConflict, "Entries already exist with a different value: %s", strings.Join(conflicts, ", "))
+	}
+
+	queryFilters, err := newQueryFiltersFromExports(exports)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error merging filters, nothing has been changed")
+	}
+
+	qf.filters = queryFilters.filters
+	qf.exports = queryFilters.exports
+	qf.dependencies = queryFilters.dependencies
+	qf.placeholders = placeholders
+
+	return result, nil
+}
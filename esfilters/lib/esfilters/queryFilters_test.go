@@ -0,0 +1,283 @@
+package esfilters
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Run with go test -race, the tests only assert the results
+// that cannot depend on how the goroutines interleave.
+
+const testConcurrency = 8
+const testIterations = 200
+
+func newTestQueryFilters(t *testing.T) (*QueryFilters) {
+	qf := NewQueryFilters()
+
+	err := qf.ImportConfig(mustMarshal(t, map[string]string{
+		"base": "host:example",
+		"errors": "%{filter:base} AND status:>=500",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = qf.AddPlaceholder("env", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return qf
+}
+
+func mustMarshal(t *testing.T, v interface{}) ([]byte) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+func run(workers int, fn func(worker int)) {
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+			fn(worker)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestQueryFiltersConcurrentAddResolve(t *testing.T) {
+	qf := newTestQueryFilters(t)
+
+	run(testConcurrency, func(worker int) {
+		for i := 0; i < testIterations; i++ {
+			name := fmt.Sprintf("w%d_%d", worker, i)
+
+			err := qf.Add(name, "%{filter:errors} AND env:%{placeholder:env}")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			query, err := qf.Resolve(fmt.Sprintf("%%{filter:%s}", name))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if expected := "((((host:example) AND status:>=500) AND env:prod))"; query != expected {
+				t.Errorf("expected %s, got %s", expected, query)
+				return
+			}
+
+			qf.List()
+			qf.Get(name)
+		}
+	})
+
+	if n := len(qf.List()); n != testConcurrency * testIterations + 2 {
+		t.Fatalf("expected %d filters, got %d", testConcurrency * testIterations + 2, n)
+	}
+}
+
+func TestQueryFiltersConcurrentAddDelete(t *testing.T) {
+	qf := newTestQueryFilters(t)
+
+	run(testConcurrency, func(worker int) {
+		for i := 0; i < testIterations; i++ {
+			name := fmt.Sprintf("w%d_%d", worker, i)
+
+			err := qf.Add(name, "%{filter:base}")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			// base is referenced by the filter being added
+			err = qf.Delete("base")
+			if err == nil {
+				t.Error("base has been deleted while still referenced")
+				return
+			}
+
+			err = qf.Delete(name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+
+	dependents, _ := qf.Dependents("base")
+	if len(dependents) != 1 || dependents[0] != "errors" {
+		t.Fatalf("expected base to only be referenced by errors, got %v", dependents)
+	}
+
+	if n := len(qf.List()); n != 2 {
+		t.Fatalf("expected 2 filters, got %d", n)
+	}
+}
+
+func TestQueryFiltersConcurrentImportConfig(t *testing.T) {
+	qf := newTestQueryFilters(t)
+
+	configs := [][]byte{
+		mustMarshal(t, map[string]string{
+			"base": "host:a",
+			"errors": "%{filter:base} AND status:>=500",
+		}),
+		mustMarshal(t, map[string]string{
+			"base": "host:b",
+			"errors": "%{filter:base} AND status:>=500",
+		}),
+	}
+
+	expected := map[string]bool{
+		"(((host:a) AND status:>=500))": true,
+		"(((host:b) AND status:>=500))": true,
+		"(((host:example) AND status:>=500))": true,
+	}
+
+	run(testConcurrency, func(worker int) {
+		for i := 0; i < testIterations; i++ {
+			if worker % 2 == 0 {
+				err := qf.ImportConfig(configs[i % 2])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				continue
+			}
+
+			// An import is never seen half done
+			query, err := qf.Resolve("%{filter:errors}")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if ! expected[query] {
+				t.Errorf("unexpected query %s", query)
+				return
+			}
+
+			_, err = qf.ExportConfig()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestQueryFiltersConcurrentMixed(t *testing.T) {
+	qf := newTestQueryFilters(t)
+	config := mustMarshal(t, map[string]string{
+		"base": "host:example",
+		"errors": "%{filter:base} AND status:>=500",
+	})
+
+	run(testConcurrency, func(worker int) {
+		for i := 0; i < testIterations; i++ {
+			name := fmt.Sprintf("w%d_%d", worker, i)
+
+			// Every operation can fail because of a concurrent import,
+			// only the race detector matters here.
+			switch i % 6 {
+				case 0:
+					qf.Add(name, "%{filter:base}")
+				case 1:
+					qf.Resolve("%{filter:errors} OR %{placeholder:env}")
+				case 2:
+					qf.Delete(fmt.Sprintf("w%d_%d", worker, i - 1))
+				case 3:
+					qf.ImportConfig(config)
+				case 4:
+					qf.ImportPlaceholdersConfig([]byte(fmt.Sprintf(`{"env": %q}`, name)))
+				case 5:
+					qf.Compile([]string{"errors"}, map[string]string{"env": "dev"})
+					qf.Update("errors", "%{filter:base} AND status:>=500")
+					qf.ExportPlaceholdersConfig()
+			}
+		}
+	})
+}
+
+func TestQueryFiltersImportPlaceholdersConfigIsAtomic(t *testing.T) {
+	qf := newTestQueryFilters(t)
+
+	err := qf.ImportPlaceholdersConfig([]byte(`{"valid": "a", "in valid": "b"}`))
+	if err == nil {
+		t.Fatal("expected an error for an invalid placeholder name")
+	}
+
+	placeholders := qf.ListPlaceholders()
+	if len(placeholders) != 1 || placeholders["env"] != "prod" {
+		t.Fatalf("placeholders changed after a failed import: %v", placeholders)
+	}
+}
+
+func TestConfigImportExporterSections(t *testing.T) {
+	config := NewConfig()
+
+	for section, importExporter := range config.importExporters() {
+		payload, err := importExporter.ExportConfig()
+		if err != nil {
+			t.Fatalf("%s: %s", section, err)
+		}
+
+		err = importExporter.ImportConfig(payload)
+		if err != nil {
+			t.Fatalf("%s: %s", section, err)
+		}
+	}
+}
+
+func TestQueryFiltersResolveEmpty(t *testing.T) {
+	qf := newTestQueryFilters(t)
+
+	for _, query := range []string{"", "  \n",} {
+		resolved, err := qf.Resolve(query)
+		if err != nil {
+			t.Errorf("Resolve(%q): unexpected error %s", query, err.Error())
+			continue
+		}
+
+		if resolved != "*" {
+			t.Errorf("Resolve(%q): expected *, got %q", query, resolved)
+		}
+	}
+}
+
+func TestQueryFiltersAddEmpty(t *testing.T) {
+	qf := newTestQueryFilters(t)
+
+	for _, query := range []string{"", "  \n",} {
+		err := qf.Add("empty", query)
+		if err == nil {
+			t.Errorf("Add(%q): expected an error", query)
+		}
+	}
+
+	lintErrors, err := LintQueryFiltersConfig(mustMarshal(t, map[string]string{
+		"empty": " ",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lintErrors) != 1 || lintErrors[0].Name != "empty" {
+		t.Errorf("Expected a lint error for the empty filter, got %v", lintErrors)
+	}
+}
@@ -0,0 +1,396 @@
+package esfilters
+
+import (
+	"unicode/utf8"
+	"strings"
+	"fmt"
+)
+
+// Lexer for the Lucene query_string syntax used by elasticsearch.
+// %{type:name} references are kept as terms so positions
+// always point inside the text that has been written by the user.
+
+type queryStringTokenType int
+
+const (
+	qsTokenEOF queryStringTokenType = iota
+	qsTokenTerm
+	qsTokenPhrase
+	qsTokenRegexp
+	qsTokenAnd
+	qsTokenOr
+	qsTokenNot
+	qsTokenPlus
+	qsTokenMinus
+	qsTokenColon
+	qsTokenComparator
+	qsTokenLParen
+	qsTokenRParen
+	qsTokenRangeStart
+	qsTokenRangeEnd
+	qsTokenTo
+	qsTokenBoost
+	qsTokenFuzzy
+)
+
+var queryStringTokenNames = map[queryStringTokenType]string{
+	qsTokenEOF: "end of query",
+	qsTokenTerm: "term",
+	qsTokenPhrase: "phrase",
+	qsTokenRegexp: "regexp",
+	qsTokenAnd: "operator AND",
+	qsTokenOr: "operator OR",
+	qsTokenNot: "operator NOT",
+	qsTokenPlus: "modifier +",
+	qsTokenMinus: "modifier -",
+	qsTokenColon: ":",
+	qsTokenComparator: "comparator",
+	qsTokenLParen: "(",
+	qsTokenRParen: ")",
+	qsTokenRangeStart: "range start",
+	qsTokenRangeEnd: "range end",
+	qsTokenTo: "TO",
+	qsTokenBoost: "boost ^",
+	qsTokenFuzzy: "fuzziness ~",
+}
+
+func (t queryStringTokenType) String() (string) {
+	return queryStringTokenNames[t]
+}
+
+type queryStringToken struct {
+	t queryStringTokenType
+	text string
+	offset int
+}
+
+// Error at a given position of a query_string.
+// Offset is in bytes, Column is the 1-based position in characters.
+type QueryStringError struct {
+	Query string
+	Offset int
+	Column int
+	Message string
+}
+
+func newQueryStringError(query string, offset int, format string, v ...interface{}) (*QueryStringError) {
+	if offset > len(query) {
+		offset = len(query)
+	}
+
+	return &QueryStringError{
+		Query: query,
+		Offset: offset,
+		Column: utf8.RuneCountInString(query[:offset]) + 1,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// Queries spanning several lines, like YAML block scalars,
+// point to the line of the error.
+func (e QueryStringError) Error() (string) {
+	if strings.Contains(e.Query, "\n") {
+		number, _, column := e.Line()
+		return fmt.Sprintf("%s at line %d, column %d", e.Message, number, column)
+	}
+
+	return fmt.Sprintf("%s at column %d", e.Message, e.Column)
+}
+
+// Line of the query holding the error with its 1-based number
+// and the 1-based column of the error in that line.
+func (e QueryStringError) Line() (int, string, int) {
+	before := e.Query[:e.Offset]
+	start := strings.LastIndex(before, "\n") + 1
+
+	end := strings.Index(e.Query[start:], "\n")
+	if end == -1 {
+		end = len(e.Query)
+	} else {
+		end += start
+	}
+
+	line := strings.TrimSuffix(e.Query[start:end], "\r")
+
+	return strings.Count(before, "\n") + 1, line, utf8.RuneCountInString(e.Query[start:e.Offset]) + 1
+}
+
+func isQueryStringSpace(c byte) (bool) {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// Characters that cannot be part of a term unless escaped
+func isQueryStringSpecial(c byte) (bool) {
+	switch c {
+		case '(', ')', '[', ']', '{', '}', '"', '^', '~', ':', '\\':
+			return true
+	}
+
+	return false
+}
+
+type queryStringLexer struct {
+	query string
+	pos int
+	tokens []*queryStringToken
+	inRange bool
+}
+
+func lexQueryString(query string) ([]*queryStringToken, error) {
+	l := &queryStringLexer{
+		query: query,
+		tokens: make([]*queryStringToken, 0),
+	}
+
+	for {
+		l.skipSpaces()
+		if l.pos >= len(l.query) {
+			break
+		}
+
+		var err error
+
+		if l.inRange {
+			err = l.lexRange()
+		} else {
+			err = l.lexToken()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l.emit(qsTokenEOF, len(l.query), len(l.query))
+
+	return l.tokens, nil
+}
+
+func (l *queryStringLexer) skipSpaces() {
+	for l.pos < len(l.query) && isQueryStringSpace(l.query[l.pos]) {
+		l.pos++
+	}
+}
+
+func (l *queryStringLexer) emit(t queryStringTokenType, start, end int) {
+	l.tokens = append(l.tokens, &queryStringToken{
+		t: t,
+		text: l.query[start:end],
+		offset: start,
+	})
+
+	l.pos = end
+}
+
+func (l *queryStringLexer) last() (queryStringTokenType) {
+	if len(l.tokens) == 0 {
+		return qsTokenEOF
+	}
+
+	return l.tokens[len(l.tokens) - 1].t
+}
+
+// Inside [ ] or { } everything up to a space or the closing bracket is a term
+func (l *queryStringLexer) lexRange() (error) {
+	start := l.pos
+
+	switch c := l.query[l.pos]; c {
+		case ']', '}':
+			l.inRange = false
+			l.emit(qsTokenRangeEnd, start, start + 1)
+			return nil
+		case '"':
+			end, err := l.scanPhrase(start)
+			if err != nil {
+				return err
+			}
+
+			l.emit(qsTokenPhrase, start, end)
+			return nil
+	}
+
+	end := start
+	for end < len(l.query) {
+		c := l.query[end]
+		if isQueryStringSpace(c) || c == ']' || c == '}' {
+			break
+		}
+
+		if c == '\\' {
+			end++
+		}
+
+		end++
+	}
+
+	if end > len(l.query) {
+		return newQueryStringError(l.query, start, "escape character at the end of the query")
+	}
+
+	if l.query[start:end] == "TO" {
+		l.emit(qsTokenTo, start, end)
+		return nil
+	}
+
+	l.emit(qsTokenTerm, start, end)
+
+	return nil
+}
+
+func (l *queryStringLexer) lexToken() (error) {
+	start := l.pos
+	c := l.query[start]
+
+	switch c {
+		case '(':
+			l.emit(qsTokenLParen, start, start + 1)
+			return nil
+		case ')':
+			l.emit(qsTokenRParen, start, start + 1)
+			return nil
+		case '[', '{':
+			l.inRange = true
+			l.emit(qsTokenRangeStart, start, start + 1)
+			return nil
+		case ']', '}':
+			return newQueryStringError(l.query, start, "unexpected %q without a range start", c)
+		case ':':
+			l.emit(qsTokenColon, start, start + 1)
+			return nil
+		case '"':
+			end, err := l.scanPhrase(start)
+			if err != nil {
+				return err
+			}
+
+			l.emit(qsTokenPhrase, start, end)
+			return nil
+		case '+':
+			l.emit(qsTokenPlus, start, start + 1)
+			return nil
+		case '-':
+			l.emit(qsTokenMinus, start, start + 1)
+			return nil
+		case '!':
+			l.emit(qsTokenNot, start, start + 1)
+			return nil
+		case '^':
+			end := l.scanNumber(start + 1)
+			if end == start + 1 {
+				return newQueryStringError(l.query, start, "boost ^ must be followed by a number")
+			}
+
+			l.emit(qsTokenBoost, start, end)
+			return nil
+		case '~':
+			l.emit(qsTokenFuzzy, start, l.scanNumber(start + 1))
+			return nil
+		case '/':
+			end := start + 1
+			for end < len(l.query) && l.query[end] != '/' {
+				if l.query[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			if end >= len(l.query) {
+				return newQueryStringError(l.query, start, "regexp is missing its closing /")
+			}
+
+			l.emit(qsTokenRegexp, start, end + 1)
+			return nil
+		case '>', '<':
+			if l.last() == qsTokenColon {
+				end := start + 1
+				if end < len(l.query) && l.query[end] == '=' {
+					end++
+				}
+
+				l.emit(qsTokenComparator, start, end)
+				return nil
+			}
+	}
+
+	end, err := l.scanTerm(start)
+	if err != nil {
+		return err
+	}
+
+	switch l.query[start:end] {
+		case "AND", "&&":
+			l.emit(qsTokenAnd, start, end)
+		case "OR", "||":
+			l.emit(qsTokenOr, start, end)
+		case "NOT":
+			l.emit(qsTokenNot, start, end)
+		default:
+			l.emit(qsTokenTerm, start, end)
+	}
+
+	return nil
+}
+
+func (l *queryStringLexer) scanPhrase(start int) (int, error) {
+	end := start + 1
+
+	for end < len(l.query) {
+		switch l.query[end] {
+			case '\\':
+				end++
+			case '"':
+				return end + 1, nil
+		}
+
+		end++
+	}
+
+	return 0, newQueryStringError(l.query, start, "phrase is missing its closing quote")
+}
+
+func (l *queryStringLexer) scanNumber(start int) (int) {
+	end := start
+
+	for end < len(l.query) && (l.query[end] == '.' || (l.query[end] >= '0' && l.query[end] <= '9')) {
+		end++
+	}
+
+	return end
+}
+
+func (l *queryStringLexer) scanTerm(start int) (int, error) {
+	end := start
+
+	for end < len(l.query) {
+		c := l.query[end]
+
+		if c == '%' {
+			if loc := QueryRegexp.FindStringIndex(l.query[end:]); loc != nil && loc[0] == 0 {
+				end += loc[1]
+				continue
+			}
+		}
+
+		if c == '\\' {
+			if end + 1 >= len(l.query) {
+				return 0, newQueryStringError(l.query, end, "escape character at the end of the query")
+			}
+
+			end += 2
+			continue
+		}
+
+		if isQueryStringSpace(c) || isQueryStringSpecial(c) || c == '!' {
+			break
+		}
+
+		end++
+	}
+
+	if end == start {
+		return 0, newQueryStringError(l.query, start, "unexpected %q", l.query[start])
+	}
+
+	return end, nil
+}
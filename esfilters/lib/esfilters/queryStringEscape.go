@@ -0,0 +1,43 @@
+package esfilters
+
+import (
+	"strings"
+	"unicode"
+	"bytes"
+)
+
+// Reserved characters of the query_string syntax except < and >
+const queryStringReserved = `+-=&|!(){}[]^"~*?:\/`
+
+var queryStringQuoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Escape value so it is searched as a single term, whatever it contains.
+// Spaces are escaped and AND, OR and NOT lose their meaning.
+// < and > cannot be escaped in a term so they are removed,
+// use QueryStringQuote for values that may contain them.
+func QueryStringEscape(value string) (string) {
+	switch value {
+		case "AND", "OR", "NOT":
+			return `\` + value
+	}
+
+	buff := &bytes.Buffer{}
+
+	for _, c := range value {
+		switch {
+			case c == '<' || c == '>':
+				continue
+			case strings.ContainsRune(queryStringReserved, c) || unicode.IsSpace(c):
+				buff.WriteByte('\\')
+		}
+
+		buff.WriteRune(c)
+	}
+
+	return buff.String()
+}
+
+// Quote value as a phrase, only \ and " have to be escaped in it
+func QueryStringQuote(value string) (string) {
+	return `"` + queryStringQuoteReplacer.Replace(value) + `"`
+}
@@ -0,0 +1,68 @@
+package esfilters
+
+import (
+	"testing"
+)
+
+var testQueryStringValues = []string{
+	"10.0.0.1",
+	"2001:db8::1",
+	"Mozilla/5.0 (X11; Linux x86_64)",
+	`C:\Windows\System32`,
+	`say "hi"`,
+	"a && b || !c",
+	"status:>=500",
+	"[1 TO 5]",
+	"{x}^2~ *?",
+	"AND",
+	"NOT",
+	"-",
+	"trailing\\",
+	"new\nline",
+}
+
+func TestQueryStringEscape(t *testing.T) {
+	for value, expected := range map[string]string{
+		"10.0.0.1": `10.0.0.1`,
+		"2001:db8::1": `2001\:db8\:\:1`,
+		"a/b c": `a\/b\ c`,
+		"x>1<2": `x12`,
+		"AND": `\AND`,
+		"ANDROID": `ANDROID`,
+		`back\slash`: `back\\slash`,
+	} {
+		if escaped := QueryStringEscape(value); escaped != expected {
+			t.Errorf("QueryStringEscape(%q): expected %s, got %s", value, expected, escaped)
+		}
+	}
+}
+
+func TestQueryStringQuote(t *testing.T) {
+	for value, expected := range map[string]string{
+		"10.0.0.1": `"10.0.0.1"`,
+		`say "hi"`: `"say \"hi\""`,
+		`a\b`: `"a\\b"`,
+		"x > 1": `"x > 1"`,
+		"": `""`,
+	} {
+		if quoted := QueryStringQuote(value); quoted != expected {
+			t.Errorf("QueryStringQuote(%q): expected %s, got %s", value, expected, quoted)
+		}
+	}
+}
+
+// Escaped and quoted values stay a single clause of the query
+func TestQueryStringEscapedValuesAreValid(t *testing.T) {
+	for _, value := range testQueryStringValues {
+		for _, query := range []string{
+			"field:" + QueryStringEscape(value),
+			"field:" + QueryStringQuote(value),
+			QueryStringQuote(value) + " AND other:1",
+		} {
+			err := ValidateQueryString(query)
+			if err != nil {
+				t.Errorf("%s: %s", query, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package esfilters
+
+// Recursive descent parser checking the query_string grammar:
+//
+//   query   := clause* with AND, OR and NOT between clauses
+//   clause  := [+|-|NOT] [field ':'] value
+//   value   := term | phrase | regexp | range | '(' query ')' | comparator term
+//   range   := ('[' | '{') bound TO bound (']' | '}')
+//
+// Terms and phrases can be followed by a boost ^N and a fuzziness ~N.
+
+type queryStringParser struct {
+	query string
+	tokens []*queryStringToken
+	pos int
+}
+
+// Check the syntax of a query_string query. The error is a *QueryStringError.
+// An empty or blank query is valid, it matches every document.
+func ValidateQueryString(query string) (error) {
+	tokens, err := lexQueryString(query)
+	if err != nil {
+		return err
+	}
+
+	p := &queryStringParser{
+		query: query,
+		tokens: tokens,
+	}
+
+	if p.peek().t == qsTokenEOF {
+		return nil
+	}
+
+	err = p.parseQuery(nil)
+	if err != nil {
+		return err
+	}
+
+	if token := p.peek(); token.t != qsTokenEOF {
+		return p.errorf(token, "unexpected %s", token.t)
+	}
+
+	return nil
+}
+
+func (p *queryStringParser) peek() (*queryStringToken) {
+	return p.tokens[p.pos]
+}
+
+func (p *queryStringParser) next() (*queryStringToken) {
+	token := p.tokens[p.pos]
+	if token.t != qsTokenEOF {
+		p.pos++
+	}
+
+	return token
+}
+
+func (p *queryStringParser) errorf(token *queryStringToken, format string, v ...interface{}) (error) {
+	return newQueryStringError(p.query, token.offset, format, v...)
+}
+
+// group is the opening parenthesis, nil at the top level
+func (p *queryStringParser) parseQuery(group *queryStringToken) (error) {
+	var operator *queryStringToken
+	clauses := 0
+
+	for {
+		token := p.peek()
+
+		switch token.t {
+			case qsTokenEOF, qsTokenRParen:
+				if operator != nil {
+					return p.errorf(operator, "%s is missing its right operand", operator.t)
+				}
+
+				if token.t == qsTokenRParen && group == nil {
+					return p.errorf(token, "unexpected ) without a matching (")
+				}
+
+				if token.t == qsTokenEOF && group != nil {
+					return p.errorf(group, "( is missing its closing )")
+				}
+
+				if clauses == 0 {
+					return p.errorf(group, "empty group")
+				}
+
+				return nil
+			case qsTokenAnd, qsTokenOr:
+				if clauses == 0 || operator != nil {
+					return p.errorf(token, "%s is missing its left operand", token.t)
+				}
+
+				operator = p.next()
+				continue
+		}
+
+		err := p.parseClause()
+		if err != nil {
+			return err
+		}
+
+		operator = nil
+		clauses++
+	}
+}
+
+func (p *queryStringParser) parseClause() (error) {
+	token := p.peek()
+
+	switch token.t {
+		case qsTokenPlus, qsTokenMinus, qsTokenNot:
+			p.next()
+
+			next := p.peek()
+			switch next.t {
+				case qsTokenEOF, qsTokenRParen, qsTokenAnd, qsTokenOr:
+					return p.errorf(token, "%s is not followed by a clause", token.t)
+			}
+
+			if token.t == qsTokenNot {
+				return p.parseClause()
+			}
+
+			if next.t == qsTokenPlus || next.t == qsTokenMinus {
+				return p.errorf(next, "unexpected %s", next.t)
+			}
+
+			return p.parseClause()
+		case qsTokenTerm:
+			p.next()
+
+			if p.peek().t == qsTokenColon {
+				colon := p.next()
+
+				return p.parseFieldValue(token, colon)
+			}
+
+			return p.parseModifiers()
+	}
+
+	return p.parseValue()
+}
+
+func (p *queryStringParser) parseFieldValue(field, colon *queryStringToken) (error) {
+	token := p.peek()
+
+	switch token.t {
+		case qsTokenComparator:
+			p.next()
+
+			switch value := p.next(); value.t {
+				case qsTokenTerm, qsTokenPhrase:
+					return nil
+				default:
+					return p.errorf(value, "%s is not followed by a value", token.text)
+			}
+		case qsTokenTerm:
+			p.next()
+
+			if next := p.peek(); next.t == qsTokenColon {
+				return p.errorf(next, "unexpected : after value of field %s, escape it or use a phrase", field.text)
+			}
+
+			return p.parseModifiers()
+		case qsTokenPhrase, qsTokenRegexp, qsTokenLParen, qsTokenRangeStart:
+			return p.parseValue()
+	}
+
+	return p.errorf(colon, "field %s is missing its value", field.text)
+}
+
+func (p *queryStringParser) parseValue() (error) {
+	token := p.next()
+
+	switch token.t {
+		case qsTokenTerm, qsTokenPhrase:
+			return p.parseModifiers()
+		case qsTokenRegexp:
+			return nil
+		case qsTokenLParen:
+			err := p.parseQuery(token)
+			if err != nil {
+				return err
+			}
+
+			p.next()
+
+			return p.parseModifiers()
+		case qsTokenRangeStart:
+			return p.parseRange(token)
+		case qsTokenColon:
+			return p.errorf(token, "unexpected : without a field name")
+	}
+
+	return p.errorf(token, "unexpected %s", token.t)
+}
+
+func (p *queryStringParser) parseRange(start *queryStringToken) (error) {
+	bound := func() (error) {
+		token := p.next()
+
+		switch token.t {
+			case qsTokenTerm, qsTokenPhrase:
+				return nil
+			case qsTokenEOF:
+				return p.errorf(start, "range is missing its closing bracket")
+		}
+
+		return p.errorf(token, "range expects a value, got %s", token.t)
+	}
+
+	err := bound()
+	if err != nil {
+		return err
+	}
+
+	if token := p.next(); token.t != qsTokenTo {
+		if token.t == qsTokenEOF {
+			return p.errorf(start, "range is missing its closing bracket")
+		}
+
+		return p.errorf(token, "range expects TO, got %s", token.t)
+	}
+
+	err = bound()
+	if err != nil {
+		return err
+	}
+
+	if token := p.next(); token.t != qsTokenRangeEnd {
+		if token.t == qsTokenEOF {
+			return p.errorf(start, "range is missing its closing bracket")
+		}
+
+		return p.errorf(token, "range expects a closing bracket, got %s", token.t)
+	}
+
+	return p.parseModifiers()
+}
+
+func (p *queryStringParser) parseModifiers() (error) {
+	for {
+		switch p.peek().t {
+			case qsTokenBoost, qsTokenFuzzy:
+				p.next()
+			default:
+				return nil
+		}
+	}
+}
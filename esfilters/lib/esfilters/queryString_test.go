@@ -0,0 +1,213 @@
+package esfilters
+
+import (
+	"testing"
+)
+
+func TestValidateQueryStringValid(t *testing.T) {
+	for _, query := range []string{
+		// Empty queries match every document
+		"",
+		"   ",
+		// Terms, wildcards and fields
+		"nginx",
+		"*",
+		"qu?ck bro*",
+		"status:500",
+		"message:hello-world",
+		"email:user@example.com",
+		"message:café",
+		"_exists_:title",
+		"book.\\*:(quick OR brown)",
+		"  padded  ",
+		// Operators
+		"a AND b",
+		"a OR b",
+		"a && b || c",
+		"a AND NOT b",
+		"a OR NOT b",
+		"a NOT b",
+		"NOT a",
+		"!a",
+		"+a -b",
+		"-status:500",
+		"a b c",
+		// Grouping
+		"(a)",
+		"(a OR b) AND c",
+		"NOT (a OR b)",
+		"((a AND b) OR (c AND d))",
+		"tags:(a b c)",
+		"title:(quick OR brown)^2",
+		// Comparators and ranges
+		"status:>=500",
+		"count:<10",
+		"date:>now-1h",
+		"age:(>=10 AND <20)",
+		"status:[400 TO 499]",
+		"status:{* TO 500}",
+		"status:[400 TO 499}",
+		"date:[now-1d TO now]",
+		"created:[2020-01-01T00:00:00 TO *]",
+		`name:["a" TO "b"]`,
+		"[1 TO 5]",
+		"status:[1 TO (]",
+		// Phrases, boosts and fuzziness
+		`"quoted phrase"`,
+		`"phrase with \"escaped\" quotes"`,
+		`message:"GET /api"`,
+		`field:"phrase"~2`,
+		"quick^2",
+		"quick^1.5 fox",
+		"fuzzy~",
+		"fuzzy~1",
+		"foo~0.8",
+		// Regexps and escapes
+		"name:/joh?n(ath[oa]n)/",
+		`path:/a\/b/`,
+		`path:\/var\/log`,
+		`ip:2001\:db8\:\:1`,
+		`a\(b\)`,
+		`C\:\\Windows`,
+		// References are kept as terms
+		"%{filter:base}",
+		"%{filter:base} AND status:%{placeholder:status}",
+	} {
+		err := ValidateQueryString(query)
+		if err != nil {
+			t.Errorf("ValidateQueryString(%q): unexpected error %s", query, err.Error())
+		}
+	}
+}
+
+func TestValidateQueryStringInvalid(t *testing.T) {
+	for _, test := range []struct{
+		query string
+		column int
+	}{
+		// Operators
+		{"a AND", 3,},
+		{"AND a", 1,},
+		{"a AND OR b", 7,},
+		{"a OR", 3,},
+		{"NOT", 1,},
+		{"-", 1,},
+		{"a -", 3,},
+		{"+-a", 2,},
+		{"NOT )", 1,},
+		// Grouping
+		{"(a", 1,},
+		{"a)", 2,},
+		{"()", 1,},
+		{"(a AND)", 4,},
+		{"a AND (b OR (c)", 7,},
+		// Fields
+		{"status:", 7,},
+		{":a", 1,},
+		{"a:b:c", 4,},
+		{"status:>", 9,},
+		{"status:>=)", 10,},
+		// Ranges
+		{"status:[1 TO", 8,},
+		{"status:[1 5]", 11,},
+		{"status:[1 TO 5 6]", 16,},
+		{"status:[1 TO ]", 14,},
+		{"a]", 2,},
+		{"a}", 2,},
+		// Phrases, escapes, regexps and boosts
+		{`"unterminated`, 1,},
+		{`a "unterminated`, 3,},
+		{`trailing\`, 9,},
+		{"/regexp", 1,},
+		{"a^", 2,},
+		{"a^x", 2,},
+		// Columns count characters, not bytes
+		{"café AND", 6,},
+	} {
+		err := ValidateQueryString(test.query)
+		if err == nil {
+			t.Errorf("ValidateQueryString(%q): expected an error", test.query)
+			continue
+		}
+
+		qsErr, ok := err.(*QueryStringError)
+		if ! ok {
+			t.Errorf("ValidateQueryString(%q): expected a *QueryStringError, got %T", test.query, err)
+			continue
+		}
+
+		if qsErr.Column != test.column {
+			t.Errorf("ValidateQueryString(%q): expected column %d, got %d (%s)", test.query, test.column, qsErr.Column, qsErr.Message)
+		}
+	}
+}
+
+func TestQueryStringErrorLine(t *testing.T) {
+	for _, test := range []struct{
+		query string
+		number int
+		line string
+		column int
+		message string
+	}{
+		{"a AND", 1, "a AND", 3, "operator AND is missing its right operand at column 3",},
+		{"program:sshd AND\n\tstatus:(500 OR\nhost:a", 2, "\tstatus:(500 OR", 9, "( is missing its closing ) at line 2, column 9",},
+		{"a\r\nb AND", 2, "b AND", 3, "operator AND is missing its right operand at line 2, column 3",},
+		{"café\nété AND", 2, "été AND", 5, "operator AND is missing its right operand at line 2, column 5",},
+	} {
+		err := ValidateQueryString(test.query)
+
+		qsErr, ok := err.(*QueryStringError)
+		if ! ok {
+			t.Errorf("ValidateQueryString(%q): expected a *QueryStringError, got %v", test.query, err)
+			continue
+		}
+
+		number, line, column := qsErr.Line()
+		if number != test.number || line != test.line || column != test.column {
+			t.Errorf("ValidateQueryString(%q): expected line %d %q column %d, got line %d %q column %d", test.query, test.number, test.line, test.column, number, line, column)
+		}
+
+		if qsErr.Error() != test.message {
+			t.Errorf("ValidateQueryString(%q): expected %q, got %q", test.query, test.message, qsErr.Error())
+		}
+	}
+}
+
+func TestLexQueryString(t *testing.T) {
+	for query, expected := range map[string][]queryStringTokenType{
+		"a AND b": {qsTokenTerm, qsTokenAnd, qsTokenTerm, qsTokenEOF,},
+		"a && b || !c": {qsTokenTerm, qsTokenAnd, qsTokenTerm, qsTokenOr, qsTokenNot, qsTokenTerm, qsTokenEOF,},
+		"+a -b": {qsTokenPlus, qsTokenTerm, qsTokenMinus, qsTokenTerm, qsTokenEOF,},
+		"f:>=5": {qsTokenTerm, qsTokenColon, qsTokenComparator, qsTokenTerm, qsTokenEOF,},
+		"f:[1 TO *}": {qsTokenTerm, qsTokenColon, qsTokenRangeStart, qsTokenTerm, qsTokenTo, qsTokenTerm, qsTokenRangeEnd, qsTokenEOF,},
+		`"a b"~2^3`: {qsTokenPhrase, qsTokenFuzzy, qsTokenBoost, qsTokenEOF,},
+		"/a.b/": {qsTokenRegexp, qsTokenEOF,},
+		`a\:b`: {qsTokenTerm, qsTokenEOF,},
+		"(%{filter:x})": {qsTokenLParen, qsTokenTerm, qsTokenRParen, qsTokenEOF,},
+		"ANDROID": {qsTokenTerm, qsTokenEOF,},
+	} {
+		tokens, err := lexQueryString(query)
+		if err != nil {
+			t.Errorf("lexQueryString(%q): unexpected error %s", query, err.Error())
+			continue
+		}
+
+		types := make([]queryStringTokenType, len(tokens))
+		for i, token := range tokens {
+			types[i] = token.t
+		}
+
+		if len(types) != len(expected) {
+			t.Errorf("lexQueryString(%q): expected %v, got %v", query, expected, types)
+			continue
+		}
+
+		for i := range types {
+			if types[i] != expected[i] {
+				t.Errorf("lexQueryString(%q): expected %v, got %v", query, expected, types)
+				break
+			}
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package esfilters
 
 import (
+	"encoding/json"
 	"regexp"
+	"bytes"
 	"strings"
 	"fmt"
 )
@@ -47,13 +49,124 @@ func QueryRegexpFunc(qf map[string]*QueryFilter, dependsOn map[string][]string)
 		switch partType {
 			case "filter":
 				if f, found := qf[partValue]; found {
+					if f.IsDSL() {
+						return fmt.Sprintf(`%%{error:dsl_filter:%s}`, partValue)
+					}
+
 					return f.ParsedQuery
 				}
 
 				return fmt.Sprintf(`%%{error:filter_not_found:%s}`, partValue)
 			case "placeholder":
+				// Placeholders are only known at resolve time, keep them
+				// in the parsed query so QueryRegexpPlaceholderFunc can
+				// replace them later on.
+				return str
 		}
 
 		return fmt.Sprintf(`%%{error:type_not_found:%s}`, partType)
 	}
 }
+
+func QueryRegexpPlaceholderFunc(placeholders map[string]string) (func (string) (string)) {
+	return func(str string) (string) {
+		part := QueryRegexp.FindStringSubmatch(str)
+		split := strings.Split(part[1], ":")
+
+		partType := split[0]
+		partValue := split[1]
+
+		if partType != "placeholder" {
+			return str
+		}
+
+		if value, found := placeholders[partValue]; found {
+			return value
+		}
+
+		return fmt.Sprintf(`%%{error:placeholder_not_found:%s}`, partValue)
+	}
+}
+
+// Replace %{aggregation:name} with the aggregation's body after its own
+// placeholders have been resolved. Placeholders from values override the
+// aggregation's defaults. Use it with replaceJSONPlaceholders so the values
+// inside JSON strings are escaped.
+func AggregationRegexpFunc(af map[string]*AggregationFilter, values map[string]string) (func (string, bool) (string)) {
+	return func(str string, quoted bool) (string) {
+		part := QueryRegexp.FindStringSubmatch(str)
+		split := strings.Split(part[1], ":")
+
+		partType := split[0]
+		partValue := split[1]
+
+		switch partType {
+			case "aggregation":
+				a, found := af[partValue]
+				if ! found {
+					return fmt.Sprintf(`%%{error:aggregation_not_found:%s}`, partValue)
+				}
+
+				return replaceJSONPlaceholders(a.Aggregation, jsonPlaceholderFunc(a.placeholders(values)))
+			case "placeholder":
+				return jsonPlaceholderFunc(values)(str, quoted)
+		}
+
+		return fmt.Sprintf(`%%{error:type_not_found:%s}`, partType)
+	}
+}
+
+func jsonPlaceholderFunc(placeholders map[string]string) (func (string, bool) (string)) {
+	replace := QueryRegexpPlaceholderFunc(placeholders)
+
+	return func(str string, quoted bool) (string) {
+		value := replace(str)
+		if quoted {
+			return jsonEscapeString(value)
+		}
+
+		return value
+	}
+}
+
+// Like ReplaceAllStringFunc on QueryRegexp, quoted tells fn whether
+// the match sits inside a string of the JSON document body.
+func replaceJSONPlaceholders(body string, fn func (str string, quoted bool) (string)) (string) {
+	buff := &bytes.Buffer{}
+	quoted, escaped := false, false
+	last := 0
+
+	for _, match := range QueryRegexp.FindAllStringIndex(body, -1) {
+		for _, c := range body[last:match[0]] {
+			switch {
+				case escaped:
+					escaped = false
+				case c == '\\':
+					escaped = quoted
+				case c == '"':
+					quoted = ! quoted
+			}
+		}
+
+		buff.WriteString(body[last:match[0]])
+		buff.WriteString(fn(body[match[0]:match[1]], quoted))
+		last = match[1]
+	}
+
+	buff.WriteString(body[last:])
+
+	return buff.String()
+}
+
+// Value escaped to be pasted between the quotes of a JSON string
+func jsonEscapeString(value string) (string) {
+	buff := &bytes.Buffer{}
+
+	encoder := json.NewEncoder(buff)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+
+	encoded := strings.TrimSuffix(buff.String(), "\n")
+
+	return encoded[1:len(encoded) - 1]
+}
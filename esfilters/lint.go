@@ -0,0 +1,57 @@
+package main
+
+import (
+	"./lib/esfilters"
+	"github.com/tehmoon/errors"
+	"strings"
+	"fmt"
+)
+
+// Print every broken filter with a marker under the error's position.
+// Returns the exit code: 1 when at least one filter is broken.
+func lint(module string, files []string) (int, error) {
+	if module != "filter" {
+		return 2, errors.Wrapf(ErrModuleNotFound, "command lint only supports module filter, got %s", module)
+	}
+
+	lintErrors, err := esfilters.LintConfigFiles(files...)
+	if err != nil {
+		return 2, err
+	}
+
+	for _, lintError := range lintErrors {
+		fmt.Println(lintError.Error())
+
+		if e, ok := lintError.Err.(*esfilters.QueryStringError); ok {
+			_, line, column := e.Line()
+
+			fmt.Printf("  %s\n", line)
+			fmt.Printf("  %s^\n", caretPadding(line, column))
+		}
+	}
+
+	if len(lintErrors) != 0 {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Blanks up to column, tabs are kept so the caret lines up with the line
+func caretPadding(line string, column int) (string) {
+	padding := make([]rune, 0, column)
+
+	for _, c := range line {
+		if len(padding) == column - 1 {
+			break
+		}
+
+		if c != '\t' {
+			c = ' '
+		}
+
+		padding = append(padding, c)
+	}
+
+	return string(padding) + strings.Repeat(" ", column - 1 - len(padding))
+}
@@ -10,22 +10,44 @@ import (
 func main() {
 	flags, err := parseFlags()
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
 		usage()
 		os.Exit(2)
 	}
 
-	config, err := esfilters.ImportConfigFromFile(flags.ConfigFile)
-	if err != nil {
-		if ok := ErrAssertSyscallErrno(err, 0x02); ok {
-		} else {
-			fmt.Fprintln(os.Stderr, err.Error())
+	// Linting has to read broken config files, it never writes them back
+	if flags.Command == "lint" {
+		code, err := lint(flags.Module, flags.ConfigFiles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errors.Wrapf(err, "Error executing command %s %s", flags.Command, flags.Module).Error())
 			os.Exit(2)
 		}
 
-		config = esfilters.NewConfig()
+		os.Exit(code)
 	}
 
-	module, err := parseModule(flags.Module, config)
+	// The server reloads the config by itself and writes every change
+	if flags.Command == "serve" {
+		err = serve(flags.Module, flags.ConfigFiles, flags.Rest)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errors.Wrapf(err, "Error executing command %s %s", flags.Command, flags.Module).Error())
+			os.Exit(2)
+		}
+
+		os.Exit(0)
+	}
+
+	config, err := importConfig(flags.ConfigFiles)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	for _, override := range config.Overrides {
+		fmt.Fprintln(os.Stderr, override.String())
+	}
+
+	module, err := parseModule(flags.Module, config, flags.Profile)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errors.Wrapf(err, "Error parsing module %s", flags.Module).Error())
 		os.Exit(2)
@@ -48,4 +70,31 @@ func main() {
 		fmt.Fprintf(os.Stderr, errors.Wrapf(err, "Error saving config file").Error())
 		os.Exit(2)
 	}
+
+	if saver, ok := module.(ModuleSaver); ok {
+		err = saver.Saved()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errors.Wrapf(err, "Error executing command %s %s", flags.Command, flags.Module).Error())
+			os.Exit(2)
+		}
+	}
+}
+
+// Only the top-level file can be created, included files must exist
+func importConfig(files []string) (*esfilters.Config, error) {
+	file := files[len(files) - 1]
+
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		files = files[:len(files) - 1]
+	}
+
+	config, err := esfilters.ImportConfigFromFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	config.SetFile(file)
+
+	return config, nil
 }
@@ -10,19 +10,37 @@ type Module interface {
 	Do() (error)
 }
 
+// Implemented by the modules writing other files
+// only once the config file has been saved
+type ModuleSaver interface {
+	Saved() (error)
+}
+
 var (
 	ErrModuleNotFound error = errors.New("module not found")
 	ErrModuleNotConfigured error = errors.New("module not configured, call Configure() first.")
 	ErrModuleAlreadyConfigured error = errors.New("module is already configured, call Do() insteadt.")
 )
 
-func parseModule(module string, config *esfilters.Config) (Module, error) {
+func parseModule(module string, config *esfilters.Config, profile string) (Module, error) {
 	var m Module
 
 	switch module {
 		case "filter":
 			filter := NewModuleFilter(config)
 			m = filter
+		case "aggregation":
+			aggregation := NewModuleAggregation(config)
+			m = aggregation
+		case "json":
+			json := NewModuleJSON(config)
+			m = json
+		case "placeholder":
+			placeholder := NewModulePlaceholder(config)
+			m = placeholder
+		case "config":
+			c := NewModuleConfig(config, profile)
+			m = c
 		default:
 			return nil, ErrModuleNotFound
 	}
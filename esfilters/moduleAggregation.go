@@ -0,0 +1,228 @@
+package main
+
+import (
+	"./lib/esfilters"
+	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/flags"
+	"flag"
+	"text/tabwriter"
+	"sort"
+	"strings"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrModuleAggregationCommandNotFound error
+	ErrModuleAggregationFlagMissing error
+)
+
+type AggregationModule struct {
+	aggregations *esfilters.AggregationFilters
+	config *esfilters.Config
+	command string
+	options interface{}
+	configured bool
+}
+
+type AggregationModuleOptionsCommandResolve struct {
+	Query string
+	Placeholders flags.Placeholders
+}
+
+type AggregationModuleOptionsCommandDelete struct {
+	Name string
+}
+
+type AggregationModuleOptionsCommandAdd struct {
+	Aggregation string
+	Name string
+	Placeholders flags.Placeholders
+}
+
+func (m *AggregationModule) configureDelete(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &AggregationModuleOptionsCommandDelete{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "Aggregation to delete")
+
+	set.Parse(rest)
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleAggregationFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m *AggregationModule) configureResolve(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &AggregationModuleOptionsCommandResolve{
+		Placeholders: make(flags.Placeholders),
+	}
+	m.options = options
+
+	set.StringVar(&options.Query, "query", "", "Aggregation to resolve")
+	set.Var(&options.Placeholders, "set", "Set placeholder's value using name=value. Can be repeated")
+
+	set.Parse(rest)
+
+	if options.Query == "" {
+		return errors.Wrapf(ErrModuleAggregationFlagMissing, "Flag -query is missing")
+	}
+
+	return nil
+}
+
+func (m *AggregationModule) configureAdd(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &AggregationModuleOptionsCommandAdd{
+		Placeholders: make(flags.Placeholders),
+	}
+	m.options = options
+
+	set.StringVar(&options.Aggregation, "aggregation", "", "JSON aggregation to add")
+	set.StringVar(&options.Name, "name", "", "Name of the aggregation")
+	set.Var(&options.Placeholders, "set", "Set placeholder's default value using name=value, an empty value makes it required. Can be repeated")
+
+	set.Parse(rest)
+
+	if options.Aggregation == "" {
+		return errors.Wrapf(ErrModuleAggregationFlagMissing, "Flag -aggregation is missing")
+	}
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleAggregationFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m AggregationModule) doDelete() (error) {
+	options, ok := m.options.(*AggregationModuleOptionsCommandDelete)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	err := m.config.AssertOwned(esfilters.ConfigSectionAggregations, options.Name)
+	if err != nil {
+		return err
+	}
+
+	return m.aggregations.Delete(options.Name)
+}
+
+func (m AggregationModule) doList() (error) {
+	aggregations := m.aggregations.List()
+
+	sort.Slice(aggregations, func(i, j int) (bool) {
+		return aggregations[i].Name < aggregations[j].Name
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 1, 1, ' ', 0)
+
+	fmt.Fprintln(writer, "Name\tBuiltin\tPlaceholders\tAggregation")
+	fmt.Fprintln(writer, "\t\t\t")
+
+	for _, aggregation := range aggregations {
+		placeholders := make([]string, 0, len(aggregation.Placeholders))
+		for name, value := range aggregation.Placeholders {
+			placeholders = append(placeholders, fmt.Sprintf("%s=%s", name, value))
+		}
+
+		sort.Strings(placeholders)
+
+		fmt.Fprintf(writer, "%s\t%t\t%s\t%s\n", aggregation.Name, aggregation.Builtin, strings.Join(placeholders, ","), aggregation.Aggregation)
+	}
+
+	writer.Flush()
+
+	return nil
+}
+
+func (m AggregationModule) doResolve() (error) {
+	options, ok := m.options.(*AggregationModuleOptionsCommandResolve)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	aggregation, err := m.aggregations.ResolvePlaceholders(options.Query, options.Placeholders)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(aggregation)
+
+	return nil
+}
+
+func (m AggregationModule) doAdd() (error) {
+	options, ok := m.options.(*AggregationModuleOptionsCommandAdd)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	return m.aggregations.Add(options.Name, options.Aggregation, options.Placeholders)
+}
+
+func (m *AggregationModule) Configure(command string, rest []string) (error) {
+	set := flag.NewFlagSet(fmt.Sprintf("%s aggregation", command), flag.ExitOnError)
+
+	var err error
+	switch command {
+		case "add":
+			err = m.configureAdd(set, rest)
+		case "delete":
+			err = m.configureDelete(set, rest)
+		case "list":
+		case "resolve":
+			err = m.configureResolve(set, rest)
+		default:
+			return errors.Wrapf(ErrModuleAggregationCommandNotFound, "command %s not found", command)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.configured = true
+	m.command = command
+
+	return nil
+}
+
+func (m AggregationModule) Do() (error) {
+	if ! m.configured {
+		return ErrModuleNotConfigured
+	}
+
+	switch m.command {
+		case "add":
+			return m.doAdd()
+		case "resolve":
+			return m.doResolve()
+		case "list":
+			return m.doList()
+		case "delete":
+			return m.doDelete()
+	}
+
+	return nil
+}
+
+func NewModuleAggregation(config *esfilters.Config) (*AggregationModule) {
+	return &AggregationModule{
+		config: config,
+		aggregations: config.Aggregations,
+	}
+}
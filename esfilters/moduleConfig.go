@@ -0,0 +1,259 @@
+package main
+
+import (
+	"./lib/esfilters"
+	"github.com/tehmoon/estools/lib/connection"
+	"gopkg.in/olivere/elastic.v5"
+	"github.com/tehmoon/errors"
+	"context"
+	"flag"
+	"fmt"
+)
+
+var (
+	ErrModuleConfigCommandNotFound error
+	ErrModuleConfigFlagMissing error
+)
+
+// Synchronizes the top-level config file with an elasticsearch index.
+// The versions of the last pull are kept next to the file in <file>.sync
+type ConfigModule struct {
+	config *esfilters.Config
+	command string
+	options interface{}
+	configured bool
+	// Cluster of -profile storing the config
+	profile string
+	// Remote snapshot of the pull, written by Saved
+	pulled *esfilters.ConfigSnapshot
+}
+
+type ConfigModuleOptionsCommandPull struct {
+	Connection connection.Config
+	Index string
+	Force bool
+}
+
+type ConfigModuleOptionsCommandPush struct {
+	Connection connection.Config
+	Index string
+}
+
+func (m *ConfigModule) configurePull(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &ConfigModuleOptionsCommandPull{}
+	options.Connection.Profile = m.profile
+	m.options = options
+
+	options.Connection.AddFlags(set)
+	set.StringVar(&options.Index, "index", "esfilters", "Index storing the config")
+	set.BoolVar(&options.Force, "force", false, "Take the remote entries when they conflict with local changes")
+
+	set.Parse(rest)
+	set.Visit(func(f *flag.Flag) {
+		options.Connection.SetFlag(f.Name)
+	})
+
+	if options.Index == "" {
+		return errors.Wrapf(ErrModuleConfigFlagMissing, "Flag -index is missing")
+	}
+
+	return nil
+}
+
+func (m *ConfigModule) configurePush(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &ConfigModuleOptionsCommandPush{}
+	options.Connection.Profile = m.profile
+	m.options = options
+
+	options.Connection.AddFlags(set)
+	set.StringVar(&options.Index, "index", "esfilters", "Index storing the config")
+
+	set.Parse(rest)
+	set.Visit(func(f *flag.Flag) {
+		options.Connection.SetFlag(f.Name)
+	})
+
+	if options.Index == "" {
+		return errors.Wrapf(ErrModuleConfigFlagMissing, "Flag -index is missing")
+	}
+
+	return nil
+}
+
+func (m ConfigModule) snapshotFile() (string) {
+	return fmt.Sprintf("%s.sync", m.config.File())
+}
+
+// Snapshot of the last pull, empty if there never was one
+func (m ConfigModule) snapshot() (*esfilters.ConfigSnapshot, error) {
+	snapshot, err := esfilters.ImportConfigSnapshotFromFile(m.snapshotFile())
+	if err != nil {
+		if ok := ErrAssertSyscallErrno(err, 0x02); ok {
+			return esfilters.NewConfigSnapshot(), nil
+		}
+
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func newConfigStorage(flags connection.Config, index string) (*esfilters.ConfigStorage, error) {
+	conn, err := connection.Load(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := conn.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := elastic.NewClient(
+		elastic.SetURL(conn.URL),
+		elastic.SetSniff(false),
+		elastic.SetHttpClient(httpClient),
+		elastic.SetGzip(conn.Gzip),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Err creating connection to server %s", conn.URL)
+	}
+
+	return esfilters.NewConfigStorage(client, index), nil
+}
+
+func (m *ConfigModule) doPull() (error) {
+	options, ok := m.options.(*ConfigModuleOptionsCommandPull)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	storage, err := newConfigStorage(options.Connection, options.Index)
+	if err != nil {
+		return err
+	}
+
+	base, err := m.snapshot()
+	if err != nil {
+		return errors.Wrap(err, "Error reading the last pull")
+	}
+
+	remote, err := storage.Pull(context.Background())
+	if err != nil {
+		return err
+	}
+
+	local, err := m.config.ExportConfig()
+	if err != nil {
+		return err
+	}
+
+	merged, err := esfilters.MergeConfigSnapshot(local, base, remote, options.Force)
+	if err != nil {
+		return err
+	}
+
+	err = m.config.ImportTopLevelConfig(merged)
+	if err != nil {
+		return errors.Wrap(err, "Error importing the pulled config")
+	}
+
+	m.pulled = remote
+
+	return nil
+}
+
+// The base of the next pull or push is only written once the merged config
+// is saved, otherwise the local changes would look unchanged next time.
+func (m ConfigModule) Saved() (error) {
+	if m.pulled == nil {
+		return nil
+	}
+
+	return m.pulled.ExportToFile(m.snapshotFile())
+}
+
+func (m ConfigModule) doPush() (error) {
+	options, ok := m.options.(*ConfigModuleOptionsCommandPush)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	storage, err := newConfigStorage(options.Connection, options.Index)
+	if err != nil {
+		return err
+	}
+
+	base, err := m.snapshot()
+	if err != nil {
+		return errors.Wrap(err, "Error reading the last pull")
+	}
+
+	local, err := m.config.ExportConfig()
+	if err != nil {
+		return err
+	}
+
+	pushed, err := storage.Push(context.Background(), local, base)
+	if pushed != nil {
+		e := pushed.ExportToFile(m.snapshotFile())
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func (m *ConfigModule) Configure(command string, rest []string) (error) {
+	set := flag.NewFlagSet(fmt.Sprintf("%s config", command), flag.ExitOnError)
+
+	var err error
+	switch command {
+		case "pull":
+			err = m.configurePull(set, rest)
+		case "push":
+			err = m.configurePush(set, rest)
+		default:
+			return errors.Wrapf(ErrModuleConfigCommandNotFound, "command %s not found", command)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.configured = true
+	m.command = command
+
+	return nil
+}
+
+func (m *ConfigModule) Do() (error) {
+	if ! m.configured {
+		return ErrModuleNotConfigured
+	}
+
+	switch m.command {
+		case "pull":
+			return m.doPull()
+		case "push":
+			return m.doPush()
+	}
+
+	return nil
+}
+
+func NewModuleConfig(config *esfilters.Config, profile string) (*ConfigModule) {
+	return &ConfigModule{
+		config: config,
+		profile: profile,
+	}
+}
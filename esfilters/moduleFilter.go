@@ -3,8 +3,13 @@ package main
 import (
 	"./lib/esfilters"
 	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/flags"
 	"flag"
 	"text/tabwriter"
+	"encoding/json"
+	"strings"
+	"bytes"
+	"sort"
 	"fmt"
 	"os"
 )
@@ -16,6 +21,7 @@ var (
 
 type FilterModule struct {
 	filters *esfilters.QueryFilters
+	config *esfilters.Config
 	command string
 	options interface{}
 	configured bool
@@ -23,17 +29,116 @@ type FilterModule struct {
 
 type FilterModuleOptionsCommandResolve struct {
 	Query string
+	Names flags.Strings
+	Placeholders flags.Placeholders
 }
 
 type FilterModuleOptionsCommandDelete struct {
 	Name string
 }
 
+type FilterModuleOptionsCommandGraph struct {
+	Name string
+	Direction string
+	Dot bool
+}
+
+type FilterModuleOptionsCommandUpdate struct {
+	Query string
+	DSL string
+	Name string
+	Metadata FilterModuleOptionsMetadata
+	// Flags passed on the command line, only them are updated
+	Changed map[string]bool
+}
+
+type FilterModuleOptionsCommandRename struct {
+	Name string
+	NewName string
+}
+
 type FilterModuleOptionsCommandAdd struct {
 	Query string
+	DSL string
+	Name string
+	Metadata FilterModuleOptionsMetadata
+}
+
+type FilterModuleOptionsCommandList struct {
+	Tag string
+}
+
+type FilterModuleOptionsCommandShow struct {
 	Name string
 }
 
+type FilterModuleOptionsCommandExport struct {
+	Names flags.Strings
+	Output string
+}
+
+type FilterModuleOptionsCommandImport struct {
+	File string
+	OnConflict string
+}
+
+type FilterModuleOptionsMetadata struct {
+	Description string
+	Tags flags.Strings
+	Owner string
+	Index string
+}
+
+func (o *FilterModuleOptionsMetadata) flags(set *flag.FlagSet) {
+	set.StringVar(&o.Description, "description", "", "Description of the filter")
+	set.Var(&o.Tags, "tag", "Tag of the filter, can be repeated")
+	set.StringVar(&o.Owner, "owner", "", "Owner of the filter")
+	set.StringVar(&o.Index, "index", "", "Index to query when the filter is used without one")
+}
+
+func (o FilterModuleOptionsMetadata) metadata() (esfilters.QueryFilterMetadata) {
+	return esfilters.QueryFilterMetadata{
+		Description: o.Description,
+		Tags: o.Tags,
+		Owner: o.Owner,
+		Index: o.Index,
+	}
+}
+
+func (m *FilterModule) configureList(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &FilterModuleOptionsCommandList{}
+	m.options = options
+
+	set.StringVar(&options.Tag, "tag", "", "Only list the filters having this tag")
+
+	set.Parse(rest)
+
+	return nil
+}
+
+func (m *FilterModule) configureShow(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &FilterModuleOptionsCommandShow{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "Filter to show")
+
+	set.Parse(rest)
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
 func (m *FilterModule) configureDelete(set *flag.FlagSet, rest []string) (error) {
 	if m.configured {
 		return ErrModuleAlreadyConfigured
@@ -58,15 +163,151 @@ func (m *FilterModule) configureResolve(set *flag.FlagSet, rest []string) (error
 		return ErrModuleAlreadyConfigured
 	}
 
-	options := &FilterModuleOptionsCommandResolve{}
+	options := &FilterModuleOptionsCommandResolve{
+		Placeholders: make(flags.Placeholders),
+	}
 	m.options = options
 
 	set.StringVar(&options.Query, "query", "", "Query to add")
+	set.Var(&options.Names, "name", "Compile the filter to the query DSL instead of resolving -query. Can be repeated")
+	set.Var(&options.Placeholders, "set", "Set placeholder's value using name=value. Can be repeated")
+
+	set.Parse(rest)
+
+	if options.Query == "" && len(options.Names) == 0 {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -query or -name is missing")
+	}
+
+	if options.Query != "" && len(options.Names) != 0 {
+		return errors.New("Flags -query and -name are mutually exclusive")
+	}
+
+	return nil
+}
+
+func (m *FilterModule) configureGraph(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &FilterModuleOptionsCommandGraph{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "Filter to start from, defaults to every filter")
+	set.StringVar(&options.Direction, "direction", "dependencies", "Follow \"dependencies\", \"dependents\" or \"both\"")
+	set.BoolVar(&options.Dot, "dot", false, "Output Graphviz DOT instead of a tree")
+
+	set.Parse(rest)
+
+	switch options.Direction {
+		case "dependencies", "dependents", "both":
+		default:
+			return errors.Errorf("Flag -direction must be one of dependencies, dependents or both, got %s", options.Direction)
+	}
+
+	return nil
+}
+
+func (m *FilterModule) configureExport(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &FilterModuleOptionsCommandExport{}
+	m.options = options
+
+	set.Var(&options.Names, "name", "Filter to export along with the filters it references. Can be repeated")
+	set.StringVar(&options.Output, "o", "", "Config file to write to, defaults to stdout")
+
+	set.Parse(rest)
+
+	if len(options.Names) == 0 {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m *FilterModule) configureImport(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &FilterModuleOptionsCommandImport{}
+	m.options = options
+
+	set.StringVar(&options.File, "file", "", "Config file to merge into the current one")
+	set.StringVar(&options.OnConflict, "on-conflict", esfilters.QueryFiltersMergeFail, "When an entry already exists with a different value: \"fail\", \"skip\" or \"overwrite\"")
+
+	set.Parse(rest)
+
+	if options.File == "" {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -file is missing")
+	}
+
+	switch options.OnConflict {
+		case esfilters.QueryFiltersMergeFail, esfilters.QueryFiltersMergeSkip, esfilters.QueryFiltersMergeOverwrite:
+		default:
+			return errors.Errorf("Flag -on-conflict must be one of fail, skip or overwrite, got %s", options.OnConflict)
+	}
+
+	return nil
+}
+
+func (m *FilterModule) configureUpdate(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &FilterModuleOptionsCommandUpdate{}
+	m.options = options
+
+	set.StringVar(&options.Query, "query", "", "New query of the filter")
+	set.StringVar(&options.DSL, "dsl", "", "New query DSL fragment of the filter, in JSON")
+	set.StringVar(&options.Name, "name", "", "Filter to update")
+	options.Metadata.flags(set)
 
 	set.Parse(rest)
 
-	if options.Query == "" {
-		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -query is missing")
+	if options.Query != "" && options.DSL != "" {
+		return errors.New("Flags -query and -dsl are mutually exclusive")
+	}
+
+	options.Changed = make(map[string]bool)
+	set.Visit(func(f *flag.Flag) {
+		options.Changed[f.Name] = true
+	})
+
+	if len(options.Changed) == 1 && options.Changed["name"] {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -query or a metadata flag is missing")
+	}
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m *FilterModule) configureRename(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &FilterModuleOptionsCommandRename{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "Filter to rename")
+	set.StringVar(&options.NewName, "new-name", "", "New name of the filter")
+
+	set.Parse(rest)
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -name is missing")
+	}
+
+	if options.NewName == "" {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -new-name is missing")
 	}
 
 	return nil
@@ -81,12 +322,18 @@ func (m *FilterModule) configureAdd(set *flag.FlagSet, rest []string) (error) {
 	m.options = options
 
 	set.StringVar(&options.Query, "query", "", "Query to add")
+	set.StringVar(&options.DSL, "dsl", "", "Query DSL fragment to add instead of -query, in JSON")
 	set.StringVar(&options.Name, "name", "", "Name of the query")
+	options.Metadata.flags(set)
 
 	set.Parse(rest)
 
-	if options.Query == "" {
-		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -query is missing")
+	if options.Query == "" && options.DSL == "" {
+		return errors.Wrapf(ErrModuleFilterFlagMissing, "Flag -query or -dsl is missing")
+	}
+
+	if options.Query != "" && options.DSL != "" {
+		return errors.New("Flags -query and -dsl are mutually exclusive")
 	}
 
 	if options.Name == "" {
@@ -102,21 +349,76 @@ func (m FilterModule) doDelete() (error) {
 		return errors.New("Error type assertion")
 	}
 
+	err := m.config.AssertOwned(esfilters.ConfigSectionFilters, options.Name)
+	if err != nil {
+		return err
+	}
+
 	return m.filters.Delete(options.Name)
 }
 
 func (m FilterModule) doList() (error) {
+	options, ok := m.options.(*FilterModuleOptionsCommandList)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
 	filters := m.filters.List()
 
+	sort.Slice(filters, func(i, j int) (bool) {
+		return filters[i].Name < filters[j].Name
+	})
+
 	writer := tabwriter.NewWriter(os.Stdout, 0, 1, 1, ' ', 0)
 
-	fmt.Fprintln(writer, "Name\tQuery")
-	fmt.Fprintln(writer, "\t")
+	fmt.Fprintln(writer, "Name\tFile\tTags\tQuery")
+	fmt.Fprintln(writer, "\t\t\t")
 
 	for _, filter := range filters {
-		fmt.Fprintf(writer, "%s\t%s\n", filter.Name, filter.Query)
+		if options.Tag != "" && ! filter.HasTag(options.Tag) {
+			continue
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", filter.Name, m.config.Origin(esfilters.ConfigSectionFilters, filter.Name), strings.Join(filter.Tags, ","), filterQuery(filter))
+	}
+
+	writer.Flush()
+
+	return nil
+}
+
+func (m FilterModule) doShow() (error) {
+	options, ok := m.options.(*FilterModuleOptionsCommandShow)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	filter, found := m.filters.Filter(options.Name)
+	if ! found {
+		return errors.Errorf("Filter %s has not been found", options.Name)
+	}
+
+	dependents, _ := m.filters.Dependents(options.Name)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 1, 1, ' ', 0)
+
+	fmt.Fprintf(writer, "Name:\t%s\n", filter.Name)
+	fmt.Fprintf(writer, "Description:\t%s\n", filter.Description)
+	fmt.Fprintf(writer, "Tags:\t%s\n", strings.Join(filter.Tags, ", "))
+	fmt.Fprintf(writer, "Owner:\t%s\n", filter.Owner)
+	fmt.Fprintf(writer, "Index:\t%s\n", filter.Index)
+	fmt.Fprintf(writer, "File:\t%s\n", m.config.Origin(esfilters.ConfigSectionFilters, filter.Name))
+
+	if filter.IsDSL() {
+		fmt.Fprintf(writer, "DSL:\t%s\n", filterQuery(filter))
+	} else {
+		fmt.Fprintf(writer, "Query:\t%s\n", filter.Query)
 	}
 
+	fmt.Fprintf(writer, "Resolved:\t%s\n", filter.ParsedQuery)
+	fmt.Fprintf(writer, "Dependencies:\t%s\n", strings.Join(filter.Dependencies, ", "))
+	fmt.Fprintf(writer, "Dependents:\t%s\n", strings.Join(dependents, ", "))
+
 	writer.Flush()
 
 	return nil
@@ -128,7 +430,28 @@ func (m FilterModule) doResolve() (error) {
 		return errors.New("Error type assertion")
 	}
 
-	query, err := m.filters.Resolve(options.Query)
+	if len(options.Names) != 0 {
+		query, err := m.filters.Compile(options.Names, options.Placeholders)
+		if err != nil {
+			return err
+		}
+
+		source, err := query.Source()
+		if err != nil {
+			return errors.Wrap(err, "Error building the query")
+		}
+
+		payload, err := json.MarshalIndent(source, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Error marshaling the query to JSON")
+		}
+
+		fmt.Println(string(payload))
+
+		return nil
+	}
+
+	query, err := m.filters.ResolvePlaceholders(options.Query, options.Placeholders)
 	if err != nil {
 		return err
 	}
@@ -138,13 +461,106 @@ func (m FilterModule) doResolve() (error) {
 	return nil
 }
 
+// Query of the filter on one line, query strings spanning several
+// lines in YAML files are joined and DSL fragments are compacted
+func filterQuery(filter *esfilters.QueryFilter) (string) {
+	if ! filter.IsDSL() {
+		return strings.Join(strings.Fields(filter.Query), " ")
+	}
+
+	buff := &bytes.Buffer{}
+
+	err := json.Compact(buff, filter.DSL)
+	if err != nil {
+		return string(filter.DSL)
+	}
+
+	return buff.String()
+}
+
+func (m FilterModule) doUpdate() (error) {
+	options, ok := m.options.(*FilterModuleOptionsCommandUpdate)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	filter, found := m.filters.Filter(options.Name)
+	if ! found {
+		return errors.Errorf("Filter %s has not been found", options.Name)
+	}
+
+	err := m.config.AssertOwned(esfilters.ConfigSectionFilters, options.Name)
+	if err != nil {
+		return err
+	}
+
+	if options.Changed["query"] {
+		err = m.filters.Update(options.Name, options.Query)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.Changed["dsl"] {
+		err = m.filters.UpdateDSL(options.Name, json.RawMessage(options.DSL))
+		if err != nil {
+			return err
+		}
+	}
+
+	metadata := filter.QueryFilterMetadata
+
+	if options.Changed["description"] {
+		metadata.Description = options.Metadata.Description
+	}
+
+	if options.Changed["tag"] {
+		metadata.Tags = options.Metadata.Tags
+	}
+
+	if options.Changed["owner"] {
+		metadata.Owner = options.Metadata.Owner
+	}
+
+	if options.Changed["index"] {
+		metadata.Index = options.Metadata.Index
+	}
+
+	return m.filters.SetMetadata(options.Name, metadata)
+}
+
+func (m FilterModule) doRename() (error) {
+	options, ok := m.options.(*FilterModuleOptionsCommandRename)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	err := m.config.AssertOwned(esfilters.ConfigSectionFilters, options.Name)
+	if err != nil {
+		return err
+	}
+
+	return m.filters.Rename(options.Name, options.NewName)
+}
+
 func (m FilterModule) doAdd() (error) {
 	options, ok := m.options.(*FilterModuleOptionsCommandAdd)
 	if ! ok {
 		return errors.New("Error type assertion")
 	}
 
-	return m.filters.Add(options.Name, options.Query)
+	var err error
+
+	if options.DSL != "" {
+		err = m.filters.AddDSL(options.Name, json.RawMessage(options.DSL))
+	} else {
+		err = m.filters.Add(options.Name, options.Query)
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.filters.SetMetadata(options.Name, options.Metadata.metadata())
 }
 
 func (m *FilterModule) Configure(command string, rest []string) (error) {
@@ -156,9 +572,22 @@ func (m *FilterModule) Configure(command string, rest []string) (error) {
 			err = m.configureAdd(set, rest)
 		case "delete":
 			err = m.configureDelete(set, rest)
+		case "update":
+			err = m.configureUpdate(set, rest)
+		case "rename":
+			err = m.configureRename(set, rest)
 		case "list":
+			err = m.configureList(set, rest)
+		case "show":
+			err = m.configureShow(set, rest)
+		case "graph":
+			err = m.configureGraph(set, rest)
 		case "resolve":
 			err = m.configureResolve(set, rest)
+		case "export":
+			err = m.configureExport(set, rest)
+		case "import":
+			err = m.configureImport(set, rest)
 		default:
 			return errors.Wrapf(ErrModuleFilterCommandNotFound, "command %s not found", command)
 	}
@@ -185,8 +614,20 @@ func (m FilterModule) Do() (error) {
 			return m.doResolve()
 		case "list":
 			return m.doList()
+		case "show":
+			return m.doShow()
 		case "delete":
 			return m.doDelete()
+		case "graph":
+			return m.doGraph()
+		case "update":
+			return m.doUpdate()
+		case "rename":
+			return m.doRename()
+		case "export":
+			return m.doExport()
+		case "import":
+			return m.doImport()
 	}
 
 	return nil
@@ -194,6 +635,7 @@ func (m FilterModule) Do() (error) {
 
 func NewModuleFilter(config *esfilters.Config) (*FilterModule) {
 	return &FilterModule{
+		config: config,
 		filters: config.Filters,
 	}
 }
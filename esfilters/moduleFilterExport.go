@@ -0,0 +1,82 @@
+package main
+
+import (
+	"./lib/esfilters"
+	"github.com/tehmoon/errors"
+	"text/tabwriter"
+	"sort"
+	"fmt"
+	"os"
+)
+
+// The exported filters form a config file of their own so they
+// can be imported or used with -c.
+func (m FilterModule) doExport() (error) {
+	options, ok := m.options.(*FilterModuleOptionsCommandExport)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	selected, err := m.filters.Select(options.Names)
+	if err != nil {
+		return err
+	}
+
+	config := esfilters.NewConfig()
+	config.Filters = selected
+
+	if options.Output != "" {
+		return config.ExportConfigToFile(options.Output)
+	}
+
+	payload, err := config.ExportConfig()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(payload))
+
+	return nil
+}
+
+func (m FilterModule) doImport() (error) {
+	options, ok := m.options.(*FilterModuleOptionsCommandImport)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	from, err := esfilters.ImportConfigFromFile(options.File)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading %s", options.File)
+	}
+
+	result, err := m.filters.Merge(from.Filters, options.OnConflict)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 1, 1, ' ', 0)
+
+	fmt.Fprintln(writer, "Type\tName\tAction")
+	fmt.Fprintln(writer, "\t\t")
+
+	printMergeResult(writer, "placeholder", result.Placeholders)
+	printMergeResult(writer, "filter", result.Filters)
+
+	writer.Flush()
+
+	return nil
+}
+
+func printMergeResult(writer *tabwriter.Writer, kind string, actions map[string]string) {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", kind, name, actions[name])
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"github.com/tehmoon/errors"
+	"strings"
+	"sort"
+	"fmt"
+)
+
+func (m FilterModule) doGraph() (error) {
+	options, ok := m.options.(*FilterModuleOptionsCommandGraph)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	roots, err := m.graphRoots(options)
+	if err != nil {
+		return err
+	}
+
+	directions := []string{options.Direction,}
+	if options.Direction == "both" {
+		directions = []string{"dependencies", "dependents",}
+	}
+
+	if options.Dot {
+		m.printGraphDot(roots, directions)
+		return nil
+	}
+
+	for i, direction := range directions {
+		if len(directions) > 1 {
+			if i > 0 {
+				fmt.Println("")
+			}
+
+			fmt.Printf("%s:\n", direction)
+		}
+
+		for _, root := range roots {
+			fmt.Println(root)
+			m.printGraphTree(root, direction, "", map[string]bool{root: true,})
+		}
+	}
+
+	return nil
+}
+
+// Without -name, start from every filter nobody depends on
+func (m FilterModule) graphRoots(options *FilterModuleOptionsCommandGraph) ([]string, error) {
+	if options.Name != "" {
+		if _, found := m.filters.Get(options.Name); ! found {
+			return nil, errors.Errorf("Filter %s has not been found", options.Name)
+		}
+
+		return []string{options.Name,}, nil
+	}
+
+	roots := make([]string, 0)
+
+	for _, filter := range m.filters.List() {
+		var next []string
+
+		if options.Direction == "dependents" {
+			next, _ = m.filters.Dependencies(filter.Name)
+		} else {
+			next, _ = m.filters.Dependents(filter.Name)
+		}
+
+		if len(next) == 0 {
+			roots = append(roots, filter.Name)
+		}
+	}
+
+	sort.Strings(roots)
+
+	return roots, nil
+}
+
+func (m FilterModule) graphNext(name, direction string) ([]string) {
+	if direction == "dependents" {
+		next, _ := m.filters.Dependents(name)
+		return next
+	}
+
+	next, _ := m.filters.Dependencies(name)
+	return next
+}
+
+func (m FilterModule) printGraphTree(name, direction, prefix string, path map[string]bool) {
+	next := m.graphNext(name, direction)
+
+	for i, child := range next {
+		branch, indent := "├── ", "│   "
+		if i == len(next) - 1 {
+			branch, indent = "└── ", "    "
+		}
+
+		fmt.Printf("%s%s%s\n", prefix, branch, child)
+
+		// Import refuses cycles but better be safe than looping forever
+		if path[child] {
+			continue
+		}
+
+		path[child] = true
+		m.printGraphTree(child, direction, prefix + indent, path)
+		delete(path, child)
+	}
+}
+
+// Edges always go from the filter to the filter it references
+func (m FilterModule) printGraphDot(roots, directions []string) {
+	edges := make(map[string]bool)
+	nodes := make(map[string]bool)
+
+	for _, direction := range directions {
+		queue := append([]string{}, roots...)
+		seen := make(map[string]bool)
+
+		for len(queue) != 0 {
+			name := queue[0]
+			queue = queue[1:]
+
+			if seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			nodes[name] = true
+
+			for _, next := range m.graphNext(name, direction) {
+				edge := fmt.Sprintf("  %q -> %q;", name, next)
+				if direction == "dependents" {
+					edge = fmt.Sprintf("  %q -> %q;", next, name)
+				}
+
+				edges[edge] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(nodes) + len(edges))
+	for node := range nodes {
+		lines = append(lines, fmt.Sprintf("  %q;", node))
+	}
+
+	sort.Strings(lines)
+
+	sortedEdges := make([]string, 0, len(edges))
+	for edge := range edges {
+		sortedEdges = append(sortedEdges, edge)
+	}
+
+	sort.Strings(sortedEdges)
+
+	fmt.Println("digraph esfilters {")
+	fmt.Println(strings.Join(append(lines, sortedEdges...), "\n"))
+	fmt.Println("}")
+}
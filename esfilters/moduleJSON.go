@@ -0,0 +1,236 @@
+package main
+
+import (
+	"./lib/esfilters"
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"io/ioutil"
+	"flag"
+	"text/tabwriter"
+	"sort"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrModuleJSONCommandNotFound error
+	ErrModuleJSONFlagMissing error
+)
+
+type JSONModule struct {
+	filters *esfilters.JSONFilters
+	config *esfilters.Config
+	command string
+	options interface{}
+	configured bool
+}
+
+type JSONModuleOptionsCommandResolve struct {
+	Name string
+	Input string
+}
+
+type JSONModuleOptionsCommandDelete struct {
+	Name string
+}
+
+type JSONModuleOptionsCommandAdd struct {
+	Path string
+	Name string
+}
+
+func (m *JSONModule) configureDelete(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &JSONModuleOptionsCommandDelete{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "JSON filter to delete")
+
+	set.Parse(rest)
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleJSONFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m *JSONModule) configureResolve(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &JSONModuleOptionsCommandResolve{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "JSON filter to apply")
+	set.StringVar(&options.Input, "input", "-", "File containing the JSON document, - is stdin")
+
+	set.Parse(rest)
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleJSONFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m *JSONModule) configureAdd(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &JSONModuleOptionsCommandAdd{}
+	m.options = options
+
+	set.StringVar(&options.Path, "path", "", "Dotted path or JSONPath to extract")
+	set.StringVar(&options.Name, "name", "", "Name of the JSON filter")
+
+	set.Parse(rest)
+
+	if options.Path == "" {
+		return errors.Wrapf(ErrModuleJSONFlagMissing, "Flag -path is missing")
+	}
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModuleJSONFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m JSONModule) doDelete() (error) {
+	options, ok := m.options.(*JSONModuleOptionsCommandDelete)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	err := m.config.AssertOwned(esfilters.ConfigSectionJSONFilters, options.Name)
+	if err != nil {
+		return err
+	}
+
+	return m.filters.Delete(options.Name)
+}
+
+func (m JSONModule) doList() (error) {
+	filters := m.filters.List()
+
+	sort.Slice(filters, func(i, j int) (bool) {
+		return filters[i].Name < filters[j].Name
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 1, 1, ' ', 0)
+
+	fmt.Fprintln(writer, "Name\tPath")
+	fmt.Fprintln(writer, "\t")
+
+	for _, filter := range filters {
+		fmt.Fprintf(writer, "%s\t%s\n", filter.Name, filter.Path)
+	}
+
+	writer.Flush()
+
+	return nil
+}
+
+func (m JSONModule) doResolve() (error) {
+	options, ok := m.options.(*JSONModuleOptionsCommandResolve)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	var (
+		data []byte
+		err error
+	)
+
+	if options.Input == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(options.Input)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error reading JSON document")
+	}
+
+	var v interface{}
+
+	err = json.Unmarshal(data, &v)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshaling JSON document")
+	}
+
+	value, err := m.filters.ResolveString(options.Name, v)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(value)
+
+	return nil
+}
+
+func (m JSONModule) doAdd() (error) {
+	options, ok := m.options.(*JSONModuleOptionsCommandAdd)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	return m.filters.Add(options.Name, options.Path)
+}
+
+func (m *JSONModule) Configure(command string, rest []string) (error) {
+	set := flag.NewFlagSet(fmt.Sprintf("%s json", command), flag.ExitOnError)
+
+	var err error
+	switch command {
+		case "add":
+			err = m.configureAdd(set, rest)
+		case "delete":
+			err = m.configureDelete(set, rest)
+		case "list":
+		case "resolve":
+			err = m.configureResolve(set, rest)
+		default:
+			return errors.Wrapf(ErrModuleJSONCommandNotFound, "command %s not found", command)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.configured = true
+	m.command = command
+
+	return nil
+}
+
+func (m JSONModule) Do() (error) {
+	if ! m.configured {
+		return ErrModuleNotConfigured
+	}
+
+	switch m.command {
+		case "add":
+			return m.doAdd()
+		case "resolve":
+			return m.doResolve()
+		case "list":
+			return m.doList()
+		case "delete":
+			return m.doDelete()
+	}
+
+	return nil
+}
+
+func NewModuleJSON(config *esfilters.Config) (*JSONModule) {
+	return &JSONModule{
+		config: config,
+		filters: config.JSONFilters,
+	}
+}
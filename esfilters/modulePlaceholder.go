@@ -0,0 +1,167 @@
+package main
+
+import (
+	"./lib/esfilters"
+	"github.com/tehmoon/errors"
+	"flag"
+	"text/tabwriter"
+	"sort"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrModulePlaceholderCommandNotFound error
+	ErrModulePlaceholderFlagMissing error
+)
+
+type PlaceholderModule struct {
+	filters *esfilters.QueryFilters
+	config *esfilters.Config
+	command string
+	options interface{}
+	configured bool
+}
+
+type PlaceholderModuleOptionsCommandDelete struct {
+	Name string
+}
+
+type PlaceholderModuleOptionsCommandAdd struct {
+	Name string
+	Value string
+}
+
+func (m *PlaceholderModule) configureDelete(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &PlaceholderModuleOptionsCommandDelete{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "Placeholder to delete")
+
+	set.Parse(rest)
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModulePlaceholderFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m *PlaceholderModule) configureAdd(set *flag.FlagSet, rest []string) (error) {
+	if m.configured {
+		return ErrModuleAlreadyConfigured
+	}
+
+	options := &PlaceholderModuleOptionsCommandAdd{}
+	m.options = options
+
+	set.StringVar(&options.Name, "name", "", "Name of the placeholder")
+	set.StringVar(&options.Value, "value", "", "Default value of the placeholder")
+
+	set.Parse(rest)
+
+	if options.Name == "" {
+		return errors.Wrapf(ErrModulePlaceholderFlagMissing, "Flag -name is missing")
+	}
+
+	return nil
+}
+
+func (m PlaceholderModule) doDelete() (error) {
+	options, ok := m.options.(*PlaceholderModuleOptionsCommandDelete)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	err := m.config.AssertOwned(esfilters.ConfigSectionPlaceholders, options.Name)
+	if err != nil {
+		return err
+	}
+
+	return m.filters.DeletePlaceholder(options.Name)
+}
+
+func (m PlaceholderModule) doList() (error) {
+	placeholders := m.filters.ListPlaceholders()
+
+	names := make([]string, 0, len(placeholders))
+	for name := range placeholders {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 1, 1, ' ', 0)
+
+	fmt.Fprintln(writer, "Name\tDefault")
+	fmt.Fprintln(writer, "\t")
+
+	for _, name := range names {
+		fmt.Fprintf(writer, "%s\t%s\n", name, placeholders[name])
+	}
+
+	writer.Flush()
+
+	return nil
+}
+
+func (m PlaceholderModule) doAdd() (error) {
+	options, ok := m.options.(*PlaceholderModuleOptionsCommandAdd)
+	if ! ok {
+		return errors.New("Error type assertion")
+	}
+
+	return m.filters.AddPlaceholder(options.Name, options.Value)
+}
+
+func (m *PlaceholderModule) Configure(command string, rest []string) (error) {
+	set := flag.NewFlagSet(fmt.Sprintf("%s placeholder", command), flag.ExitOnError)
+
+	var err error
+	switch command {
+		case "add":
+			err = m.configureAdd(set, rest)
+		case "delete":
+			err = m.configureDelete(set, rest)
+		case "list":
+		default:
+			return errors.Wrapf(ErrModulePlaceholderCommandNotFound, "command %s not found", command)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.configured = true
+	m.command = command
+
+	return nil
+}
+
+func (m PlaceholderModule) Do() (error) {
+	if ! m.configured {
+		return ErrModuleNotConfigured
+	}
+
+	switch m.command {
+		case "add":
+			return m.doAdd()
+		case "list":
+			return m.doList()
+		case "delete":
+			return m.doDelete()
+	}
+
+	return nil
+}
+
+func NewModulePlaceholder(config *esfilters.Config) (*PlaceholderModule) {
+	return &PlaceholderModule{
+		config: config,
+		filters: config.Filters,
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"./lib/esfilters"
+	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/flags"
+	"github.com/gorilla/mux"
+	"github.com/fsnotify/fsnotify"
+	"encoding/json"
+	"path/filepath"
+	"net/http"
+	"flag"
+	"sort"
+	"sync"
+	"time"
+	"net"
+	"log"
+)
+
+// Serves the filters of the config over HTTP. Every request goes through
+// the same QueryFilters methods as the commands so the validation rules
+// are the same. The config is reloaded when one of its files changes.
+type Server struct {
+	sync *sync.Mutex
+	config *esfilters.Config
+	files []string
+	router *mux.Router
+	listener *net.TCPListener
+}
+
+type ServerOptions struct {
+	Listen string
+}
+
+type serverFilter struct {
+	Name string `json:"name"`
+	Query string `json:"query,omitempty"`
+	DSL json.RawMessage `json:"dsl,omitempty"`
+	ParsedQuery string `json:"parsed_query,omitempty"`
+	Dependencies []string `json:"dependencies"`
+	File string `json:"file"`
+	esfilters.QueryFilterMetadata
+}
+
+type serverResolveRequest struct {
+	Query string `json:"query"`
+	Placeholders map[string]string `json:"placeholders"`
+}
+
+type serverResolveResponse struct {
+	Query string `json:"query"`
+}
+
+type serverAddRequest struct {
+	Name string `json:"name"`
+	Query string `json:"query"`
+	DSL json.RawMessage `json:"dsl"`
+	esfilters.QueryFilterMetadata
+}
+
+type serverError struct {
+	Error string `json:"error"`
+}
+
+func serve(module string, files []string, rest []string) (error) {
+	if module != "filter" {
+		return errors.Wrapf(ErrModuleNotFound, "command serve only supports module filter, got %s", module)
+	}
+
+	options := &ServerOptions{}
+
+	set := flag.NewFlagSet("serve filter", flag.ExitOnError)
+	set.StringVar(&options.Listen, "listen", "127.0.0.1:9201", "Address to listen on")
+	set.Parse(rest)
+
+	server, err := NewServer(files, options)
+	if err != nil {
+		return err
+	}
+
+	return server.Start()
+}
+
+func NewServer(files []string, options *ServerOptions) (*Server, error) {
+	config, err := importConfig(files)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &Server{
+		sync: &sync.Mutex{},
+		config: config,
+		files: files,
+		router: mux.NewRouter(),
+	}
+
+	server.router.
+		HandleFunc("/filters", server.HTTPGetFilters()).
+		Methods("GET")
+
+	server.router.
+		HandleFunc("/filters", server.HTTPPostFilters()).
+		Methods("POST")
+
+	server.router.
+		HandleFunc("/filters/{name}", server.HTTPGetFilter()).
+		Methods("GET")
+
+	server.router.
+		HandleFunc("/filters/{name}", server.HTTPDeleteFilter()).
+		Methods("DELETE")
+
+	server.router.
+		HandleFunc("/resolve", server.HTTPGetResolve()).
+		Methods("GET")
+
+	server.router.
+		HandleFunc("/resolve", server.HTTPPostResolve()).
+		Methods("POST")
+
+	addr, err := net.ResolveTCPAddr("tcp", options.Listen)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to resolve listen address")
+	}
+
+	server.listener, err = net.ListenTCP(addr.Network(), addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error listening on address: %s", addr)
+	}
+
+	return server, nil
+}
+
+func (s *Server) Start() (error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "Error creating file watcher")
+	}
+	defer watcher.Close()
+
+	err = s.watch(watcher)
+	if err != nil {
+		return err
+	}
+
+	go s.reloadOnChange(watcher)
+
+	server := &http.Server{
+		WriteTimeout: 5 * time.Second,
+		ReadTimeout: 5 * time.Second,
+		Handler: s.router,
+	}
+
+	server.Addr = s.listener.Addr().String()
+	log.Printf("Listening on %s\n", server.Addr)
+
+	err = server.Serve(s.listener)
+	if err != nil {
+		if err != http.ErrServerClosed {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Directories are watched instead of the files because
+// editors often replace the file rather than writing to it.
+func (s *Server) watch(watcher *fsnotify.Watcher) (error) {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	for _, file := range append(s.config.Files(), s.config.File()) {
+		err := watcher.Add(filepath.Dir(file))
+		if err != nil {
+			return errors.Wrapf(err, "Error watching %s", file)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) watched(p string) (bool) {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	for _, file := range append(s.config.Files(), s.config.File()) {
+		if filepath.Clean(file) == filepath.Clean(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) reloadOnChange(watcher *fsnotify.Watcher) {
+	// Changes usually come in bursts, wait for the last one
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	for {
+		select {
+			case event, ok := <-watcher.Events:
+				if ! ok {
+					return
+				}
+
+				if event.Op & (fsnotify.Write | fsnotify.Create | fsnotify.Rename | fsnotify.Remove) == 0 {
+					continue
+				}
+
+				if s.watched(event.Name) {
+					timer.Reset(100 * time.Millisecond)
+				}
+			case err, ok := <-watcher.Errors:
+				if ! ok {
+					return
+				}
+
+				log.Println(errors.Wrap(err, "Error watching config files").Error())
+			case <-timer.C:
+				err := s.reload()
+				if err != nil {
+					log.Println(errors.Wrap(err, "Error reloading config, keeping the previous one").Error())
+					continue
+				}
+
+				// Newly included files have to be watched too
+				err = s.watch(watcher)
+				if err != nil {
+					log.Println(err.Error())
+				}
+		}
+	}
+}
+
+func (s *Server) reload() (error) {
+	config, err := importConfig(s.files)
+	if err != nil {
+		return err
+	}
+
+	for _, override := range config.Overrides {
+		log.Println(override.String())
+	}
+
+	s.sync.Lock()
+	s.config = config
+	s.sync.Unlock()
+
+	log.Println("Config reloaded")
+
+	return nil
+}
+
+func (s *Server) current() (*esfilters.Config) {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	return s.config
+}
+
+func newServerFilter(config *esfilters.Config, filter *esfilters.QueryFilter) (*serverFilter) {
+	dependencies, _ := config.Filters.Dependencies(filter.Name)
+
+	return &serverFilter{
+		Name: filter.Name,
+		Query: filter.Query,
+		DSL: filter.DSL,
+		ParsedQuery: filter.ParsedQuery,
+		Dependencies: dependencies,
+		File: config.Origin(esfilters.ConfigSectionFilters, filter.Name),
+		QueryFilterMetadata: filter.QueryFilterMetadata,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, &serverError{
+		Error: err.Error(),
+	})
+}
+
+func (s *Server) HTTPGetFilters() (http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := s.current()
+		tag := r.URL.Query().Get("tag")
+
+		filters := config.Filters.List()
+
+		sort.Slice(filters, func(i, j int) (bool) {
+			return filters[i].Name < filters[j].Name
+		})
+
+		response := make([]*serverFilter, 0, len(filters))
+
+		for _, filter := range filters {
+			if tag != "" && ! filter.HasTag(tag) {
+				continue
+			}
+
+			response = append(response, newServerFilter(config, filter))
+		}
+
+		writeJSON(w, 200, response)
+	}
+}
+
+func (s *Server) HTTPGetFilter() (http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := s.current()
+		name := mux.Vars(r)["name"]
+
+		filter, found := config.Filters.Filter(name)
+		if ! found {
+			writeError(w, 404, errors.Errorf("Filter %s has not been found", name))
+			return
+		}
+
+		writeJSON(w, 200, newServerFilter(config, filter))
+	}
+}
+
+func (s *Server) resolve(w http.ResponseWriter, request *serverResolveRequest) {
+	query, err := s.current().Filters.ResolvePlaceholders(request.Query, request.Placeholders)
+	if err != nil {
+		writeError(w, 400, err)
+		return
+	}
+
+	writeJSON(w, 200, &serverResolveResponse{
+		Query: query,
+	})
+}
+
+// Placeholders are passed as repeated set=name=value parameters
+func (s *Server) HTTPGetResolve() (http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+
+		placeholders := make(flags.Placeholders)
+		for _, value := range values["set"] {
+			err := placeholders.Set(value)
+			if err != nil {
+				writeError(w, 400, err)
+				return
+			}
+		}
+
+		s.resolve(w, &serverResolveRequest{
+			Query: values.Get("query"),
+			Placeholders: placeholders,
+		})
+	}
+}
+
+func (s *Server) HTTPPostResolve() (http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &serverResolveRequest{}
+
+		err := json.NewDecoder(r.Body).Decode(request)
+		if err != nil {
+			writeError(w, 400, errors.Wrap(err, "Error decoding request"))
+			return
+		}
+
+		s.resolve(w, request)
+	}
+}
+
+// Changes are written to the top-level file right away. The lock is held
+// until then so a reload cannot drop the change. A change that cannot be
+// written is undone so the config keeps matching the file.
+func (s *Server) HTTPPostFilters() (http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &serverAddRequest{}
+
+		err := json.NewDecoder(r.Body).Decode(request)
+		if err != nil {
+			writeError(w, 400, errors.Wrap(err, "Error decoding request"))
+			return
+		}
+
+		if request.Name == "" {
+			writeError(w, 400, errors.New("Field name is missing"))
+			return
+		}
+
+		s.sync.Lock()
+		defer s.sync.Unlock()
+
+		filters := s.config.Filters
+
+		if _, found := filters.Filter(request.Name); found {
+			writeError(w, 409, errors.Errorf("Filter %s is already declared", request.Name))
+			return
+		}
+
+		if request.DSL != nil {
+			err = filters.AddDSL(request.Name, request.DSL)
+		} else {
+			err = filters.Add(request.Name, request.Query)
+		}
+		if err != nil {
+			writeError(w, 400, err)
+			return
+		}
+
+		err = filters.SetMetadata(request.Name, request.QueryFilterMetadata)
+		if err == nil {
+			err = s.config.ExportConfigToFile(s.config.File())
+		}
+		if err != nil {
+			e := filters.Delete(request.Name)
+			if e != nil {
+				err = errors.Wrapf(err, "Error rolling back filter %s, the config differs from the file (%s)", request.Name, e.Error())
+			}
+
+			writeError(w, 500, err)
+			return
+		}
+
+		filter, _ := filters.Filter(request.Name)
+		writeJSON(w, 201, newServerFilter(s.config, filter))
+	}
+}
+
+func (s *Server) HTTPDeleteFilter() (http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		s.sync.Lock()
+		defer s.sync.Unlock()
+
+		filters := s.config.Filters
+
+		filter, found := filters.Filter(name)
+		if ! found {
+			writeError(w, 404, errors.Errorf("Filter %s has not been found", name))
+			return
+		}
+
+		err := s.config.AssertOwned(esfilters.ConfigSectionFilters, name)
+		if err != nil {
+			writeError(w, 409, err)
+			return
+		}
+
+		err = filters.Delete(name)
+		if err != nil {
+			writeError(w, 409, err)
+			return
+		}
+
+		err = s.config.ExportConfigToFile(s.config.File())
+		if err != nil {
+			e := restoreFilter(filters, filter)
+			if e != nil {
+				err = errors.Wrapf(err, "Error rolling back filter %s, the config differs from the file (%s)", name, e.Error())
+			}
+
+			writeError(w, 500, err)
+			return
+		}
+
+		w.WriteHeader(204)
+	}
+}
+
+// Add back a deleted filter, it had no dependents
+// so nothing else has to be restored.
+func restoreFilter(filters *esfilters.QueryFilters, filter *esfilters.QueryFilter) (error) {
+	var err error
+
+	if filter.IsDSL() {
+		err = filters.AddDSL(filter.Name, filter.DSL)
+	} else {
+		err = filters.Add(filter.Name, filter.Query)
+	}
+	if err != nil {
+		return err
+	}
+
+	return filters.SetMetadata(filter.Name, filter.QueryFilterMetadata)
+}
@@ -4,15 +4,25 @@ import (
 	"flag"
 	"os"
 	"fmt"
+	"strings"
+	"github.com/tehmoon/estools/lib/connection"
+	"github.com/tehmoon/estools/lib/flags"
+	"github.com/tehmoon/estools/lib/format"
 )
 
 type Flags struct {
 	QueryStringQuery string
-	Server string
+	Connection connection.Config
 	Index string
+	// Index of the profile, used when neither -index nor the filter set one
+	DefaultIndex string
 	Template string
-	ConfigFile string
+	Format string
+	Fields []string
+	ConfigFiles flags.Strings
 	FilterName string
+	Extract string
+	Placeholders flags.Placeholders
 	From string
 	To string
 	Size int
@@ -36,16 +46,32 @@ func parseFlags() (*Flags) {
 	flag.IntVar(&flags.ScrollSize, "scroll-size", 500, "Document to return between each scroll")
 	flag.StringVar(&flags.QueryStringQuery, "query", "*", "Elasticsearch query string query")
 	flag.StringVar(&flags.FilterName, "filter-name", "", "If specified use the esfilter's filter as the query")
-	flag.StringVar(&flags.ConfigFile, "config", "", "Use configuration file created by esfilters")
-	flag.StringVar(&flags.Server, "server", "http://localhost:9200", "Specify elasticsearch server to query")
-	flag.StringVar(&flags.Index, "index", "", "Specify the elasticsearch index to query")
-	flag.StringVar(&flags.Template, "template", "{{ . | json }}", "Specify Go text/template. You can use the function 'json' or 'json_indent'.")
+	flag.Var(&flags.ConfigFiles, "config", "Use configuration file created by esfilters, can be repeated to layer files")
+	flag.StringVar(&flags.Extract, "extract", "", "Only output the value extracted by the esfilters's JSON filter instead of using -template")
+	flag.Var(&flags.Placeholders, "set", "Set esfilters placeholder's value using name=value. Can be repeated")
+	flags.Connection.AddFlags(flag.CommandLine)
+	flags.Connection.AddProfileFlag(flag.CommandLine)
+	flag.StringVar(&flags.Index, "index", "", "Specify the elasticsearch index to query. Defaults to the index of -filter-name, then of -profile")
+	flag.StringVar(&flags.Format, "format", "", "Output format instead of -template, one of " + strings.Join(format.Formats, ", "))
+	fields := flag.String("fields", "", "Comma separated fields written by -format, nested fields use dots like \"a.b\". Defaults to the fields of the first document")
+	flag.StringVar(&flags.Template, "template", "{{ . | json }}", "Specify Go text/template. See the README for the available functions.")
 	flag.BoolVar(&flags.CountOnly, "count-only", false, "Only displays the match number")
-	flag.StringVar(&flags.Aggregation, "aggregation", "", "Elastic Aggregation query")
+	flag.StringVar(&flags.Aggregation, "aggregation", "", "Elastic Aggregation query. When -config is used, %{aggregation:name} references are resolved")
 
 	flag.Parse()
 
-	if flags.Index == "" {
+	flag.Visit(func(f *flag.Flag) {
+		flags.Connection.SetFlag(f.Name)
+	})
+
+	err := applyProfile(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	// The index can come from the filter's metadata or the profile
+	if flags.Index == "" && flags.DefaultIndex == "" && flags.FilterName == "" {
 		fmt.Fprintln(os.Stderr, "Flag \"-index\" is required")
 		flag.Usage()
 		os.Exit(2)
@@ -75,12 +101,64 @@ func parseFlags() (*Flags) {
 		os.Exit(2)
 	}
 
-	if flags.FilterName != "" && flags.ConfigFile == "" {
+	if flags.FilterName != "" && len(flags.ConfigFiles) == 0 {
 		fmt.Fprintln(os.Stderr, "When \"-filter-name\" flag is used, flag \"-config\" has to be specified")
 		flag.Usage()
 		os.Exit(2)
 	}
 
+	if flags.Extract != "" && len(flags.ConfigFiles) == 0 {
+		fmt.Fprintln(os.Stderr, "When \"-extract\" flag is used, flag \"-config\" has to be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Extract != "" && flags.Template != "{{ . | json }}" {
+		fmt.Fprintln(os.Stderr, "Flags \"-extract\" and \"-template\" are mutually exclusive")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Extract != "" && (flags.CountOnly || flags.Aggregation != "") {
+		fmt.Fprintln(os.Stderr, "Flag \"-extract\" cannot be used with \"-count-only\" or \"-aggregation\"")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	flags.Fields = format.ParseFields(*fields)
+
+	if flags.Format != "" {
+		if ! format.IsFormat(flags.Format) {
+			fmt.Fprintf(os.Stderr, "Flag \"-format\" has to be one of %s\n", strings.Join(format.Formats, ", "))
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		if flags.Extract != "" || flags.Template != "{{ . | json }}" {
+			fmt.Fprintln(os.Stderr, "Flags \"-format\", \"-extract\" and \"-template\" are mutually exclusive")
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		if flags.CountOnly || flags.Aggregation != "" {
+			fmt.Fprintln(os.Stderr, "Flag \"-format\" cannot be used with \"-count-only\" or \"-aggregation\"")
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	if len(flags.Fields) != 0 && flags.Format == "" {
+		fmt.Fprintln(os.Stderr, "When \"-fields\" flag is used, flag \"-format\" has to be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if len(flags.Placeholders) != 0 && len(flags.ConfigFiles) == 0 {
+		fmt.Fprintln(os.Stderr, "When \"-set\" flag is used, flag \"-config\" has to be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	if flags.FilterName != "" && (flags.QueryStringQuery != "*" && flags.QueryStringQuery != "") {
 		fmt.Fprintln(os.Stderr, "Flags \"-filter-name\" and \"-query\" are mutually exclusive")
 		flag.Usage()
@@ -108,9 +186,40 @@ func parseFlags() (*Flags) {
 	return flags
 }
 
+// Defaults of the -profile flag, the flags set on the command line win
+func applyProfile(flags *Flags) (error) {
+	profile, err := connection.ReadProfile(flags.Connection.Profile)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	flags.DefaultIndex = profile.Index
+
+	// Documents are sorted by their timestamp unless -sort says otherwise
+	if profile.TimestampField != "" && ! set["timestamp-field"] {
+		flags.TimestampField = profile.TimestampField
+
+		if ! set["sort"] {
+			flags.Sort = profile.TimestampField
+		}
+	}
+
+	if profile.Config != "" && ! set["config"] {
+		flags.ConfigFiles = []string{profile.Config,}
+	}
+
+	return nil
+}
+
 func init() {
 	flag.Usage = func () {
-		fmt.Fprintf(os.Stderr, "Usage of %s: [-config=file] [-query=Query | <-config=file> <-filter-name=FilterName>] <-server=Url> <-index=Index> [-to=date] [-from=date] [-timestamp-field=field] [-template=Template] [-sort=Field] [-asc] [-size=Size] [-count-only] [-scroll-size=Size] [-aggregation=Aggregation]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage of %s: [-config=file] [-query=Query | <-config=file> <-filter-name=FilterName>] [-set=name=value] [-server=Url] [-username=user [-password=pass] | -api-key=key | -bearer-token=token] [-client-cert=file -client-key=file] [-ca-cert=file] [-insecure] [-timeout=duration] [-gzip] [-profile=name] [-index=Index] [-to=date] [-from=date] [-timestamp-field=field] [-template=Template | <-config=file> <-extract=JSONFilterName> | -format=Format [-fields=a,b,c.d]] [-sort=Field] [-asc] [-size=Size] [-count-only] [-scroll-size=Size] [-aggregation=Aggregation]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 }
+
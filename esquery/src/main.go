@@ -8,47 +8,112 @@ import (
 	"context"
 	"log"
 	"gopkg.in/olivere/elastic.v5"
-	"text/template"
 	"github.com/tehmoon/errors"
 	"github.com/tehmoon/estools/esfilters/lib/esfilters"
+	"github.com/tehmoon/estools/lib/connection"
+	"github.com/tehmoon/estools/lib/format"
+	"github.com/tehmoon/estools/lib/templates"
 )
 
 func main() {
 	flags := parseFlags()
 
-	tmpl, err := template.New("root").Funcs(functionTemplates).Parse(flags.Template)
+	var renderer format.Renderer
+
+	tmpl, err := templates.New().Parse(flags.Template)
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Error parsing default template").Error())
 	}
 
-	client, err := elastic.NewClient(elastic.SetURL(flags.Server), elastic.SetSniff(false))
+	renderer = tmpl
+
+	conn, err := connection.Load(flags.Connection)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	httpClient, err := conn.HTTPClient()
 	if err != nil {
-		log.Fatal(errors.Wrapf(err, "Err creating connection to server %s", flags.Server).Error())
+		log.Fatal(err.Error())
 	}
 
-	if flags.ConfigFile != "" {
-		config, err := esfilters.ImportConfigFromFile(flags.ConfigFile)
+	client, err := elastic.NewClient(
+		elastic.SetURL(conn.URL),
+		elastic.SetSniff(false),
+		elastic.SetHttpClient(httpClient),
+		elastic.SetGzip(conn.Gzip),
+	)
+	if err != nil {
+		log.Fatal(errors.Wrapf(err, "Err creating connection to server %s", conn.URL).Error())
+	}
+
+	var query elastic.Query
+
+	if len(flags.ConfigFiles) != 0 {
+		config, err := esfilters.ImportConfigFromFiles(flags.ConfigFiles...)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
 
+		for _, override := range config.Overrides {
+			log.Println(override.String())
+		}
+
 		if flags.FilterName != "" {
-			flags.QueryStringQuery, err = config.Filters.Resolve(fmt.Sprintf(`%%{filter:%s}`, flags.FilterName))
+			query, err = config.Filters.Compile([]string{flags.FilterName}, flags.Placeholders)
 			if err != nil {
 				log.Fatal(errors.Wrapf(err, "Err resolving -filter-name option").Error())
 			}
+
+			if flags.Index == "" {
+				filter, _ := config.Filters.Filter(flags.FilterName)
+				flags.Index = filter.Index
+			}
 		} else {
-			flags.QueryStringQuery, err = config.Filters.Resolve(flags.QueryStringQuery)
+			flags.QueryStringQuery, err = config.Filters.ResolvePlaceholders(flags.QueryStringQuery, flags.Placeholders)
 			if err != nil {
 				log.Fatal(errors.Wrapf(err, "Err resolving -query option").Error())
 			}
 		}
+
+		if flags.Aggregation != "" {
+			flags.Aggregation, err = config.Aggregations.ResolvePlaceholders(flags.Aggregation, flags.Placeholders)
+			if err != nil {
+				log.Fatal(errors.Wrapf(err, "Err resolving -aggregation option").Error())
+			}
+		}
+
+		if flags.Extract != "" {
+			renderer, err = NewExtractRenderer(config.JSONFilters, flags.Extract)
+			if err != nil {
+				log.Fatal(errors.Wrapf(err, "Err resolving -extract option").Error())
+			}
+		}
+	}
+
+	if query == nil {
+		query = elastic.NewQueryStringQuery(flags.QueryStringQuery)
+	}
+
+	if flags.Index == "" {
+		if flags.DefaultIndex == "" {
+			log.Fatalf("Filter %s has no default index, -index is required", flags.FilterName)
+		}
+
+		flags.Index = flags.DefaultIndex
 	}
 
-	qs := elastic.NewQueryStringQuery(flags.QueryStringQuery)
+	var output format.Writer = format.NewRendererWriter(os.Stdout, renderer)
+
+	if flags.Format != "" {
+		output, err = format.New(os.Stdout, flags.Format, flags.Fields)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
 
 	rq := elastic.NewRangeQuery(flags.TimestampField).Gte(flags.From).Lt(flags.To)
-	bq := elastic.NewBoolQuery().Must(qs, rq)
+	bq := elastic.NewBoolQuery().Must(query, rq)
 
 	if flags.Aggregation == "" {
 		res, err := client.Scroll(flags.Index).
@@ -70,7 +135,7 @@ func main() {
 				totalHits = res.Hits.TotalHits
 			}
 
-			err = tmpl.Execute(os.Stdout, totalHits)
+			err = renderer.Execute(os.Stdout, totalHits)
 			if err != nil {
 				log.Fatalf(errors.Wrap(err, "Error executing template").Error())
 			}
@@ -97,9 +162,9 @@ func main() {
 				continue
 			}
 
-			err = tmpl.Execute(os.Stdout, jresp)
+			err = output.Write(jresp)
 			if err != nil {
-				log.Fatalf(errors.Wrap(err, "Error executing template").Error())
+				log.Fatalf(errors.Wrap(err, "Error writing document").Error())
 			}
 
 			counter++
@@ -128,9 +193,9 @@ func main() {
 				jresp := make(map[string]interface{})
 				json.Unmarshal(*hit.Source, &jresp)
 
-				err = tmpl.Execute(os.Stdout, jresp)
+				err = output.Write(jresp)
 				if err != nil {
-					log.Fatalf(errors.Wrap(err, "Error executing template").Error())
+					log.Fatalf(errors.Wrap(err, "Error writing document").Error())
 				}
 
 				counter++
@@ -139,6 +204,11 @@ func main() {
 			scrollId = res.ScrollId
 		}
 
+		err = output.Flush()
+		if err != nil {
+			log.Fatalf(errors.Wrap(err, "Error writing documents").Error())
+		}
+
 		_, err = client.ClearScroll(scrollId).
 			Do(context.Background())
 		if err != nil {
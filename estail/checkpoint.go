@@ -0,0 +1,283 @@
+package main
+
+import (
+	"github.com/tehmoon/errors"
+	"gopkg.in/olivere/elastic.v5"
+	"github.com/tehmoon/estools/lib/format"
+	"encoding/json"
+	"path/filepath"
+	"io/ioutil"
+	"os/signal"
+	"syscall"
+	"sync"
+	"time"
+	"log"
+	"fmt"
+	"os"
+)
+
+// Sort values of the last emitted document of a source: the timestamp in epoch
+// milliseconds and the tiebreaker, a string or a number depending on
+// the field, so documents sharing the same timestamp are not lost.
+type Checkpoint struct {
+	Timestamp int64 `json:"timestamp"`
+	Tiebreaker interface{} `json:"tiebreaker"`
+}
+
+// Checkpoint of the hit from the values it has been sorted with. The
+// timestamp is read from the document when the sort value is not a date.
+func NewCheckpointFromHit(hit *elastic.SearchHit, field string) (*Checkpoint, error) {
+	if len(hit.Sort) != 2 {
+		return nil, errors.Errorf("Document %s has %d sort values instead of 2", hit.Id, len(hit.Sort))
+	}
+
+	checkpoint := &Checkpoint{
+		Tiebreaker: hit.Sort[1],
+	}
+
+	if timestamp, ok := hit.Sort[0].(float64); ok {
+		checkpoint.Timestamp = int64(timestamp)
+
+		return checkpoint, nil
+	}
+
+	timestamp, err := sourceTimestamp(hit, field)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint.Timestamp = timestamp
+
+	return checkpoint, nil
+}
+
+// Timestamp in epoch milliseconds of field in the document,
+// either a RFC3339 date or a number of milliseconds.
+func sourceTimestamp(hit *elastic.SearchHit, field string) (int64, error) {
+	doc := make(map[string]interface{})
+
+	if hit.Source != nil {
+		err := json.Unmarshal(*hit.Source, &doc)
+		if err != nil {
+			return 0, errors.Wrapf(err, "Error unmarshaling document %s", hit.Id)
+		}
+	}
+
+	value, found := format.Lookup(doc, field)
+	if ! found {
+		return 0, errors.Errorf("Document %s has no field %s", hit.Id, field)
+	}
+
+	switch value := value.(type) {
+		case float64:
+			return int64(value), nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return 0, errors.Wrapf(err, "Error parsing field %s of document %s", field, hit.Id)
+			}
+
+			return t.UnixNano() / int64(time.Millisecond), nil
+	}
+
+	return 0, errors.Errorf("Field %s of document %s is a %T, not a date", field, hit.Id, value)
+}
+
+func (c Checkpoint) Time() (time.Time) {
+	return time.Unix(0, c.Timestamp * int64(time.Millisecond)).UTC()
+}
+
+// Returns true if c sorts before checkpoint
+func (c Checkpoint) Before(checkpoint Checkpoint) (bool) {
+	if c.Timestamp != checkpoint.Timestamp {
+		return c.Timestamp < checkpoint.Timestamp
+	}
+
+	switch a := c.Tiebreaker.(type) {
+		case float64:
+			if b, ok := checkpoint.Tiebreaker.(float64); ok {
+				return a < b
+			}
+		case string:
+			if b, ok := checkpoint.Tiebreaker.(string); ok {
+				return a < b
+			}
+	}
+
+	return fmt.Sprint(c.Tiebreaker) < fmt.Sprint(checkpoint.Tiebreaker)
+}
+
+// Positions of the sources by label, written as {"sources": {"label": checkpoint}}
+type Checkpoints map[string]Checkpoint
+
+// Label of the position in files written before the sources had labels,
+// it is used when there is a single source.
+const legacyCheckpointLabel = ""
+
+type checkpointsFile struct {
+	Sources Checkpoints `json:"sources"`
+}
+
+// Write to a temporary file in the same directory then rename it
+// so the file is either the old or the new checkpoint, never half written.
+func (c Checkpoints) WriteFile(p string) (error) {
+	payload, err := json.Marshal(checkpointsFile{Sources: c,})
+	if err != nil {
+		return errors.Wrap(err, "Error marshaling checkpoint to JSON")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(p), filepath.Base(p) + ".tmp")
+	if err != nil {
+		return errors.Wrap(err, "Error creating temporary checkpoint file")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(payload)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	e := tmp.Close()
+	if err == nil {
+		err = e
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "Error writing temporary checkpoint file")
+	}
+
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		return errors.Wrap(err, "Error replacing checkpoint file")
+	}
+
+	return nil
+}
+
+// Returns empty checkpoints if the file does not exist yet
+func ReadCheckpoints(p string) (Checkpoints, error) {
+	checkpoints := make(Checkpoints)
+
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoints, nil
+		}
+
+		return nil, errors.Wrap(err, "Error reading checkpoint file")
+	}
+
+	file := &struct{
+		checkpointsFile
+		Checkpoint
+	}{}
+
+	err = json.Unmarshal(data, file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error unmarshaling checkpoint file %s", p)
+	}
+
+	if file.Sources == nil {
+		file.Sources = Checkpoints{legacyCheckpointLabel: file.Checkpoint,}
+	}
+
+	for label, checkpoint := range file.Sources {
+		if checkpoint.Timestamp == 0 || checkpoint.Tiebreaker == nil {
+			return nil, errors.Errorf("Checkpoint file %s has no timestamp or no tiebreaker for source %q", p, label)
+		}
+
+		checkpoints[label] = checkpoint
+	}
+
+	return checkpoints, nil
+}
+
+// Keeps the position up to date and writes it at most once per interval
+type Checkpointer struct {
+	sync *sync.Mutex
+	file string
+	interval time.Duration
+	checkpoints Checkpoints
+	saved time.Time
+	dirty bool
+}
+
+func (c *Checkpointer) Update(label string, checkpoint Checkpoint) {
+	if c == nil {
+		return
+	}
+
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.checkpoints[label] = checkpoint
+	c.dirty = true
+}
+
+// Write the position if it changed and the interval elapsed, force
+// ignores the interval. Does nothing when c is nil so the callers do
+// not have to check whether -checkpoint is set.
+func (c *Checkpointer) Save(force bool) (error) {
+	if c == nil {
+		return nil
+	}
+
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	if ! c.dirty || (! force && time.Since(c.saved) < c.interval) {
+		return nil
+	}
+
+	err := c.checkpoints.WriteFile(c.file)
+	if err != nil {
+		return err
+	}
+
+	c.saved = time.Now()
+	c.dirty = false
+
+	return nil
+}
+
+// The positions of the sources not tailed anymore are kept in the file
+func NewCheckpointer(file string, interval time.Duration, checkpoints Checkpoints) (*Checkpointer) {
+	c := &Checkpointer{
+		sync: &sync.Mutex{},
+		file: file,
+		interval: interval,
+		checkpoints: make(Checkpoints),
+	}
+
+	for label, checkpoint := range checkpoints {
+		if label != legacyCheckpointLabel {
+			c.checkpoints[label] = checkpoint
+		}
+	}
+
+	return c
+}
+
+// Write the last position before exiting on SIGINT or SIGTERM. The batch
+// being written is finished and the output flushed before saving.
+func saveCheckpointOnSignal(checkpointer *Checkpointer, batch sync.Locker, flush func() (error)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+
+		batch.Lock()
+
+		err := flush()
+		if err == nil {
+			err = checkpointer.Save(true)
+		}
+
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"gopkg.in/olivere/elastic.v5"
+	"encoding/json"
+	"path/filepath"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+	"os"
+)
+
+func newTestDir(t *testing.T) (string) {
+	dir, err := ioutil.TempDir("", "estail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestCheckpointsRoundTrip(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "checkpoint")
+
+	checkpoints := Checkpoints{
+		"nginx": {Timestamp: 1577880000123, Tiebreaker: "doc#42",},
+		"app": {Timestamp: 1577880000456, Tiebreaker: float64(7),},
+	}
+
+	err := checkpoints.WriteFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadCheckpoints(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ! reflect.DeepEqual(read, checkpoints) {
+		t.Errorf("Expected %v, got %v", checkpoints, read)
+	}
+
+	// The temporary file is renamed, nothing else is left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("Expected only the checkpoint file, got %d files", len(files))
+	}
+}
+
+func TestReadCheckpointsMissingFile(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	checkpoints, err := ReadCheckpoints(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checkpoints) != 0 {
+		t.Errorf("Expected no checkpoints, got %v", checkpoints)
+	}
+}
+
+func TestReadCheckpointsLegacyFile(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "checkpoint")
+
+	err := ioutil.WriteFile(p, []byte(`{"timestamp": 1577880000123, "tiebreaker": "doc#42"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints, err := ReadCheckpoints(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Checkpoints{legacyCheckpointLabel: {Timestamp: 1577880000123, Tiebreaker: "doc#42",},}
+	if ! reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("Expected %v, got %v", expected, checkpoints)
+	}
+}
+
+// A broken file is an error rather than a silent restart from the newest document
+func TestReadCheckpointsCorruptFile(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"truncated": `{"sources": {"nginx": {"timestamp": 15778`,
+		"not json": "garbage",
+		"empty": "",
+		"no tiebreaker": `{"sources": {"nginx": {"timestamp": 1577880000123}}}`,
+		"no timestamp": `{"sources": {"nginx": {"tiebreaker": "doc#42"}}}`,
+		"legacy without timestamp": `{}`,
+	} {
+		p := filepath.Join(dir, "checkpoint")
+
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ReadCheckpoints(p)
+		if err == nil {
+			t.Errorf("Expected an error reading the %s checkpoint file", name)
+		}
+	}
+}
+
+func TestCheckpointerSave(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "checkpoint")
+	previous := Checkpoints{
+		legacyCheckpointLabel: {Timestamp: 1, Tiebreaker: "legacy",},
+		"stopped": {Timestamp: 2, Tiebreaker: "stopped",},
+	}
+
+	checkpointer := NewCheckpointer(p, time.Hour, previous)
+
+	// Nothing changed, nothing written
+	err := checkpointer.Save(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(p); ! os.IsNotExist(err) {
+		t.Fatal("Checkpoint written without any update")
+	}
+
+	checkpointer.Update("nginx", Checkpoint{Timestamp: 3, Tiebreaker: "doc#3",})
+
+	err = checkpointer.Save(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpointer.Update("nginx", Checkpoint{Timestamp: 4, Tiebreaker: "doc#4",})
+
+	// Within the interval only a forced save writes
+	err = checkpointer.Save(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadCheckpoints(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Checkpoints{
+		"stopped": {Timestamp: 2, Tiebreaker: "stopped",},
+		"nginx": {Timestamp: 3, Tiebreaker: "doc#3",},
+	}
+	if ! reflect.DeepEqual(read, expected) {
+		t.Errorf("Expected %v, got %v", expected, read)
+	}
+
+	// The nil checkpointer of a run without -checkpoint does nothing
+	var none *Checkpointer
+	none.Update("nginx", Checkpoint{Timestamp: 5, Tiebreaker: "doc#5",})
+
+	err = none.Save(true)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckpointBefore(t *testing.T) {
+	for _, test := range []struct{
+		a, b Checkpoint
+		before bool
+	}{
+		{Checkpoint{1, "b",}, Checkpoint{2, "a",}, true,},
+		{Checkpoint{2, "a",}, Checkpoint{1, "b",}, false,},
+		{Checkpoint{1, "a",}, Checkpoint{1, "b",}, true,},
+		{Checkpoint{1, "b",}, Checkpoint{1, "a",}, false,},
+		{Checkpoint{1, float64(2),}, Checkpoint{1, float64(10),}, true,},
+		{Checkpoint{1, "a",}, Checkpoint{1, "a",}, false,},
+	} {
+		if before := test.a.Before(test.b); before != test.before {
+			t.Errorf("%v.Before(%v): expected %t, got %t", test.a, test.b, test.before, before)
+		}
+	}
+}
+
+func TestNewCheckpointFromHit(t *testing.T) {
+	source := json.RawMessage(`{"event": {"created": "2020-01-01T12:00:00.123Z"}}`)
+
+	for name, test := range map[string]struct{
+		hit *elastic.SearchHit
+		expected Checkpoint
+	}{
+		"date sort value": {
+			hit: &elastic.SearchHit{Id: "1", Sort: []interface{}{float64(1577880000123), "doc#1",},},
+			expected: Checkpoint{1577880000123, "doc#1",},
+		},
+		"timestamp from the document": {
+			hit: &elastic.SearchHit{Id: "2", Sort: []interface{}{"2020-01-01T12:00:00.123Z", "doc#2",}, Source: &source,},
+			expected: Checkpoint{1577880000123, "doc#2",},
+		},
+	} {
+		checkpoint, err := NewCheckpointFromHit(test.hit, "event.created")
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+
+		if ! reflect.DeepEqual(*checkpoint, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, *checkpoint)
+		}
+	}
+
+	_, err := NewCheckpointFromHit(&elastic.SearchHit{Id: "3", Sort: []interface{}{float64(1),},}, "@timestamp")
+	if err == nil {
+		t.Error("Expected an error for a hit without a tiebreaker")
+	}
+}
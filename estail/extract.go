@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"fmt"
+	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/esfilters/lib/esfilters"
+)
+
+// Render only the value extracted by an esfilters JSON filter.
+// Documents without that value are skipped.
+type ExtractRenderer struct {
+	filters *esfilters.JSONFilters
+	name string
+}
+
+func NewExtractRenderer(filters *esfilters.JSONFilters, name string) (*ExtractRenderer, error) {
+	if _, found := filters.Get(name); ! found {
+		return nil, errors.Errorf("JSON filter %s has not been found", name)
+	}
+
+	return &ExtractRenderer{
+		filters: filters,
+		name: name,
+	}, nil
+}
+
+func (r ExtractRenderer) Execute(w io.Writer, v interface{}) (error) {
+	value, err := r.filters.ResolveString(r.name, v)
+	if err != nil {
+		if e, ok := err.(*errors.Error); ok {
+			if e.Root() == esfilters.ErrJSONPathNotFound {
+				return nil
+			}
+		}
+
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, value)
+
+	return err
+}
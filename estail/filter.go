@@ -0,0 +1,108 @@
+package main
+
+import (
+	"regexp"
+	"bytes"
+	"io"
+	"os"
+)
+
+// ANSI codes around the -highlight matches
+const (
+	highlightStart = "\x1b[1;31m"
+	highlightEnd = "\x1b[0m"
+)
+
+// Greps and highlights the rendered output a line at a time. The first
+// skip lines, like the header of the csv format, are written as is.
+type LineFilter struct {
+	w io.Writer
+	grep *regexp.Regexp
+	grepV *regexp.Regexp
+	highlight *regexp.Regexp
+	skip int
+	buff []byte
+}
+
+// Regexes can be nil to not grep or not highlight
+func NewLineFilter(w io.Writer, grep, grepV, highlight *regexp.Regexp, skip int) (*LineFilter) {
+	return &LineFilter{
+		w: w,
+		grep: grep,
+		grepV: grepV,
+		highlight: highlight,
+		skip: skip,
+	}
+}
+
+// Lines are written once complete
+func (f *LineFilter) Write(p []byte) (int, error) {
+	f.buff = append(f.buff, p...)
+
+	for {
+		i := bytes.IndexByte(f.buff, '\n')
+		if i == -1 {
+			break
+		}
+
+		err := f.writeLine(f.buff[:i + 1])
+		if err != nil {
+			return 0, err
+		}
+
+		f.buff = f.buff[i + 1:]
+	}
+
+	return len(p), nil
+}
+
+func (f *LineFilter) writeLine(line []byte) (error) {
+	if f.skip > 0 {
+		f.skip--
+
+		_, err := f.w.Write(line)
+
+		return err
+	}
+
+	if f.grep != nil && ! f.grep.Match(line) {
+		return nil
+	}
+
+	if f.grepV != nil && f.grepV.Match(line) {
+		return nil
+	}
+
+	if f.highlight != nil {
+		line = f.highlight.ReplaceAllFunc(line, func(match []byte) ([]byte) {
+			return []byte(highlightStart + string(match) + highlightEnd)
+		})
+	}
+
+	_, err := f.w.Write(line)
+
+	return err
+}
+
+// Matches of grep and grepV on the text of a field
+func grepValue(value string, grep, grepV *regexp.Regexp) (bool) {
+	if grep != nil && ! grep.MatchString(value) {
+		return false
+	}
+
+	if grepV != nil && grepV.MatchString(value) {
+		return false
+	}
+
+	return true
+}
+
+// Colors are only written to terminals
+func isTerminal(f *os.File) (bool) {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode() & os.ModeCharDevice != 0
+}
@@ -2,38 +2,106 @@ package main
 
 import (
 	"flag"
+	"time"
 	"os"
 	"fmt"
+	"strings"
+	"regexp"
+	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/connection"
+	"github.com/tehmoon/estools/lib/flags"
+	"github.com/tehmoon/estools/lib/format"
 )
 
 type Flags struct {
-	QueryStringQuery string
-	Server string
-	Index string
+	Queries FlagQueries
+	// Labels of the -query flags, paired by position
+	QueryLabels flags.Strings
+	Connection connection.Config
+	Indexes FlagLabeledValues
+	// Index of the profile, used when neither -index nor the filter set one
+	DefaultIndex string
 	Template string
-	ConfigFile string
-	FilterName string
+	Format string
+	Fields []string
+	ConfigFiles flags.Strings
+	Extract string
+	Placeholders flags.Placeholders
 	Tail bool
 	Start string
 	End string
+	Checkpoint string
+	CheckpointInterval time.Duration
+	TimestampField string
+	Tiebreaker string
+	Lookback time.Duration
+	Highlight FlagRegexp
+	Grep FlagRegexp
+	GrepV FlagRegexp
+	GrepField string
+	ESHighlight bool
+	Stats time.Duration
+	StatsField string
+	StatsTop int
 }
 
 func parseFlags() (*Flags) {
 	flags := &Flags{}
 
-	flag.BoolVar(&flags.Tail, "tail", false, "Keep scrolling on new data. Cannot be used with \"-end\" flag")
-	flag.StringVar(&flags.Start, "start", "", "Specify when to start fetching. Elasticserach date format. Defaults to \"now\" when \"-tail\" is set")
-	flag.StringVar(&flags.End, "end", "", "Specify when to end fetching. Elasticserach date format. Cannot be used with \"-tail\" flag")
-	flag.StringVar(&flags.QueryStringQuery, "query", "*", "Elasticsearch query string query")
-	flag.StringVar(&flags.FilterName, "filter-name", "", "If specified use the esfilter's filter as the query")
-	flag.StringVar(&flags.ConfigFile, "config", "", "Use configuration file created by esfilters")
-	flag.StringVar(&flags.Server, "server", "http://localhost:9200", "Specify elasticsearch server to query")
-	flag.StringVar(&flags.Index, "index", "", "Specify the elasticsearch index to query")
-	flag.StringVar(&flags.Template, "template", "{{ . | json }}", "Specify Go text/template. You can use the function 'json' or 'json_indent'.")
+	flag.BoolVar(&flags.Tail, "tail", false, "Keep fetching new data after -start, switching to live tailing once caught up. Cannot be used with \"-end\" flag. Implied when neither -start nor -end are set")
+	flag.StringVar(&flags.Start, "start", "", "Specify when to start fetching, like \"now-1h\" or \"2020-01-01T10:00:00Z\". Elasticserach date format or epoch milliseconds. Defaults to the newest document")
+	flag.StringVar(&flags.End, "end", "", "Specify when to end fetching, then exit. A replay with -end always terminates. Elasticserach date format or epoch milliseconds. Requires \"-start\". Cannot be used with \"-tail\" flag")
+	flag.StringVar(&flags.TimestampField, "timestamp-field", "@timestamp", "Timestamp field, nested fields use dots like \"event.created\"")
+	flag.Var(flags.Queries.Var(false), "query", "Elasticsearch query string query. Can be repeated, paired with -index by position (default \"*\")")
+	flag.Var(&flags.QueryLabels, "query-label", "Label of the -query at the same position, the n-th -query-label labels the n-th -query. Can be repeated")
+	flag.Var(flags.Queries.Var(true), "filter-name", "If specified use the esfilter's filter as the query, label=name to set the label. Can be repeated, paired with -index by position")
+	flag.Var(&flags.ConfigFiles, "config", "Use configuration file created by esfilters, can be repeated to layer files")
+	flag.StringVar(&flags.Extract, "extract", "", "Only output the value extracted by the esfilters's JSON filter instead of using -template")
+	flag.Var(&flags.Placeholders, "set", "Set esfilters placeholder's value using name=value. Can be repeated")
+	flags.Connection.AddFlags(flag.CommandLine)
+	flags.Connection.AddProfileFlag(flag.CommandLine)
+	flag.Var(&flags.Indexes, "index", "Specify the elasticsearch index to query, label=index to set the label. Can be repeated. Defaults to the index of -filter-name, then of -profile")
+	flag.StringVar(&flags.Tiebreaker, "tiebreaker", "_uid", "Unique field sorting the documents sharing the same timestamp")
+	flag.DurationVar(&flags.Lookback, "lookback", 10 * time.Second, "Search again the documents this much older than the last one to catch the late ones")
+	flag.StringVar(&flags.Checkpoint, "checkpoint", "", "File keeping the position of the last document, used to resume after a restart")
+	flag.DurationVar(&flags.CheckpointInterval, "checkpoint-interval", 5 * time.Second, "How often the checkpoint is written")
+	flag.StringVar(&flags.Format, "format", "", "Output format instead of -template, one of " + strings.Join(format.Formats, ", "))
+	fields := flag.String("fields", "", "Comma separated fields written by -format, nested fields use dots like \"a.b\". Defaults to the fields of the first document")
+	flag.Var(&flags.Highlight, "highlight", "Color the matches of the regex in the output, only when it is a terminal")
+	flag.Var(&flags.Grep, "grep", "Only output the lines matching the regex, or the documents when -grep-field is set")
+	flag.Var(&flags.GrepV, "grep-v", "Do not output the lines matching the regex, or the documents when -grep-field is set")
+	flag.StringVar(&flags.GrepField, "grep-field", "", "Apply -grep and -grep-v to this field of the documents instead of the output, nested fields use dots like \"a.b\"")
+	flag.BoolVar(&flags.ESHighlight, "es-highlight", false, "Ask Elasticsearch to highlight the terms of the query, the fragments are in ._highlight")
+	flag.DurationVar(&flags.Stats, "stats", 0, "Only print the number of documents and the rate for each interval instead of the documents")
+	flag.StringVar(&flags.StatsField, "stats-field", "", "Also print the top values of this field with -stats")
+	flag.IntVar(&flags.StatsTop, "stats-top", 5, "Number of values printed by -stats-field")
+	flag.StringVar(&flags.Template, "template", "{{ . | json }}", "Specify Go text/template. See the README for the available functions.")
 
 	flag.Parse()
 
-	if flags.Index == "" {
+	flag.Visit(func(f *flag.Flag) {
+		flags.Connection.SetFlag(f.Name)
+	})
+
+	err := applyProfile(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	err = flags.Queries.LabelQueries(flags.QueryLabels)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if len(flags.Queries) == 0 {
+		flags.Queries = append(flags.Queries, QueryFlag{LabeledValue: LabeledValue{Value: "*",},})
+	}
+
+	// The index can come from the filter's metadata
+	if len(flags.Indexes) == 0 && flags.DefaultIndex == "" && ! flags.Queries.Filters() {
 		fmt.Fprintln(os.Stderr, "-index is required")
 		flag.Usage()
 		os.Exit(2)
@@ -45,24 +113,114 @@ func parseFlags() (*Flags) {
 		os.Exit(2)
 	}
 
-	if flags.FilterName != "" && flags.ConfigFile == "" {
+	if flags.Queries.HasFilter() && len(flags.ConfigFiles) == 0 {
 		fmt.Fprintln(os.Stderr, "when -filter-name is used, -config has to be specified")
 		flag.Usage()
 		os.Exit(2)
 	}
 
-	if flags.FilterName != "" && (flags.QueryStringQuery != "*" && flags.QueryStringQuery != "") {
-		fmt.Fprintln(os.Stderr, "-filter-name and -query are mutually exclusive")
+	if flags.Extract != "" && len(flags.ConfigFiles) == 0 {
+		fmt.Fprintln(os.Stderr, "when -extract is used, -config has to be specified")
 		flag.Usage()
 		os.Exit(2)
 	}
 
-	if flags.Start == "" && flags.Tail {
-		flags.Start = "now"
+	if flags.Extract != "" && flags.Template != "{{ . | json }}" {
+		fmt.Fprintln(os.Stderr, "-extract and -template are mutually exclusive")
+		flag.Usage()
+		os.Exit(2)
 	}
 
+	flags.Fields = format.ParseFields(*fields)
+
+	if flags.Format != "" {
+		if ! format.IsFormat(flags.Format) {
+			fmt.Fprintf(os.Stderr, "-format has to be one of %s\n", strings.Join(format.Formats, ", "))
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		if flags.Extract != "" || flags.Template != "{{ . | json }}" {
+			fmt.Fprintln(os.Stderr, "-format, -extract and -template are mutually exclusive")
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	if len(flags.Fields) != 0 && flags.Format == "" {
+		fmt.Fprintln(os.Stderr, "when -fields is used, -format has to be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if len(flags.Placeholders) != 0 && len(flags.ConfigFiles) == 0 {
+		fmt.Fprintln(os.Stderr, "when -set is used, -config has to be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.GrepField != "" && flags.Grep.Regexp == nil && flags.GrepV.Regexp == nil {
+		fmt.Fprintln(os.Stderr, "when -grep-field is used, -grep or -grep-v has to be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Stats < 0 {
+		fmt.Fprintln(os.Stderr, "-stats cannot be negative")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Stats != 0 && (flags.Start != "" || flags.End != "" || flags.Checkpoint != "" || flags.Format != "" || flags.Extract != "" || flags.Grep.Regexp != nil || flags.GrepV.Regexp != nil) {
+		fmt.Fprintln(os.Stderr, "-stats cannot be used with -start, -end, -checkpoint, -format, -extract, -grep or -grep-v")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.StatsField != "" && flags.Stats == 0 {
+		fmt.Fprintln(os.Stderr, "when -stats-field is used, -stats has to be specified")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.StatsTop < 1 {
+		fmt.Fprintln(os.Stderr, "-stats-top cannot be less than 1")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.End != "" && flags.Start == "" {
+		fmt.Fprintln(os.Stderr, "-end requires -start")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Without a time range estail follows the newest documents
+	if flags.Start == "" && flags.End == "" {
+		flags.Tail = true
+	}
+
+	// Tailing after -end would skip the documents between -end and now
 	if flags.Tail && flags.End != "" {
-		fmt.Fprintln(os.Stderr, "-end and -tail are mutually exclusive")
+		fmt.Fprintln(os.Stderr, "-end and -tail are mutually exclusive, a replay with -end always terminates. Use -start with -tail to replay then keep tailing")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.TimestampField == "" {
+		fmt.Fprintln(os.Stderr, "-timestamp-field cannot be empty")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Tiebreaker == "" {
+		fmt.Fprintln(os.Stderr, "-tiebreaker cannot be empty")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Lookback < 0 {
+		fmt.Fprintln(os.Stderr, "-lookback cannot be negative")
 		flag.Usage()
 		os.Exit(2)
 	}
@@ -72,9 +230,211 @@ func parseFlags() (*Flags) {
 	return flags
 }
 
+// Defaults of the -profile flag, the flags set on the command line win
+func applyProfile(flags *Flags) (error) {
+	profile, err := connection.ReadProfile(flags.Connection.Profile)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	flags.DefaultIndex = profile.Index
+
+	if profile.TimestampField != "" && ! set["timestamp-field"] {
+		flags.TimestampField = profile.TimestampField
+	}
+
+	if profile.Config != "" && ! set["config"] {
+		flags.ConfigFiles = []string{profile.Config,}
+	}
+
+	return nil
+}
+
 func init() {
 	flag.Usage = func () {
-		fmt.Fprintf(os.Stderr, "Usage of %s: [-config=file] [-query=Query | <-config=file> <-filter-name=FilterName>] <-server=Url> <-index=Index> [-template=Template]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage of %s: [-config=file] [-query=Query [-query-label=label] | <-config=file> <-filter-name=[label=]FilterName>]... [-set=name=value] [-server=Url] [-username=user [-password=pass] | -api-key=key | -bearer-token=token] [-client-cert=file -client-key=file] [-ca-cert=file] [-insecure] [-timeout=duration] [-gzip] [-profile=name] [-index=[label=]Index]... [-start=date [-end=date | -tail]] [-timestamp-field=field] [-template=Template | <-config=file> <-extract=JSONFilterName> | -format=Format [-fields=a,b,c.d]] [-checkpoint=file] [-checkpoint-interval=duration] [-tiebreaker=field] [-lookback=duration] [-highlight=regex] [-grep=regex] [-grep-v=regex] [-grep-field=field] [-es-highlight] [-stats=interval [-stats-field=field] [-stats-top=N]]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 }
+
+// Value of a repeatable flag with an optional label like nginx=logs-nginx-*
+type LabeledValue struct {
+	Label string
+	Value string
+}
+
+func (v LabeledValue) String() (string) {
+	if v.Label == "" {
+		return v.Value
+	}
+
+	return v.Label + "=" + v.Value
+}
+
+func parseLabeledValue(value string) (LabeledValue) {
+	match := labelRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return LabeledValue{Value: value,}
+	}
+
+	return LabeledValue{
+		Label: match[1],
+		Value: match[2],
+	}
+}
+
+var (
+	labelRegexp = regexp.MustCompile(`^([a-zA-Z0-9_-]+)=(.+)$`)
+	labelNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+type FlagLabeledValues []LabeledValue
+
+func (f FlagLabeledValues) String() (string) {
+	values := make([]string, len(f))
+
+	for i := range f {
+		values[i] = f[i].String()
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (f *FlagLabeledValues) Set(value string) (error) {
+	*f = append(*f, parseLabeledValue(value))
+
+	return nil
+}
+
+// Query string or esfilters filter name
+type QueryFlag struct {
+	LabeledValue
+	Filter bool
+}
+
+// -query and -filter-name in the order they are set
+type FlagQueries []QueryFlag
+
+// flag.Value appending queries or filters
+func (f *FlagQueries) Var(filter bool) (flag.Value) {
+	return &flagQueriesValue{
+		queries: f,
+		filter: filter,
+	}
+}
+
+// True if every query is a filter
+func (f FlagQueries) Filters() (bool) {
+	for _, query := range f {
+		if ! query.Filter {
+			return false
+		}
+	}
+
+	return len(f) != 0
+}
+
+// Set the labels of the queries that are not filters, in order.
+// Filters are labeled with label=name instead.
+func (f FlagQueries) LabelQueries(labels []string) (error) {
+	queries := 0
+
+	for i := range f {
+		if f[i].Filter {
+			continue
+		}
+
+		if queries < len(labels) {
+			if ! labelNameRegexp.MatchString(labels[queries]) {
+				return errors.Errorf("-query-label %q can only have letters, digits, _ and -", labels[queries])
+			}
+
+			f[i].Label = labels[queries]
+		}
+
+		queries++
+	}
+
+	if len(labels) > queries {
+		return errors.Errorf("-query-label is set %d times and -query %d times, they are paired by position", len(labels), queries)
+	}
+
+	return nil
+}
+
+func (f FlagQueries) HasFilter() (bool) {
+	for _, query := range f {
+		if query.Filter {
+			return true
+		}
+	}
+
+	return false
+}
+
+type flagQueriesValue struct {
+	queries *FlagQueries
+	filter bool
+}
+
+func (v flagQueriesValue) String() (string) {
+	if v.queries == nil {
+		return ""
+	}
+
+	values := make([]string, 0)
+
+	for _, query := range *v.queries {
+		if query.Filter == v.filter {
+			values = append(values, query.String())
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+// Only filter names take a label, queries like status=500 are kept
+// whole and labeled with -query-label
+func (v flagQueriesValue) Set(value string) (error) {
+	query := QueryFlag{
+		LabeledValue: LabeledValue{Value: value,},
+		Filter: v.filter,
+	}
+
+	if v.filter {
+		query.LabeledValue = parseLabeledValue(value)
+	}
+
+	*v.queries = append(*v.queries, query)
+
+	return nil
+}
+
+// Regex compiled when the flag is parsed, nil when not set
+type FlagRegexp struct {
+	*regexp.Regexp
+}
+
+func (f FlagRegexp) String() (string) {
+	if f.Regexp == nil {
+		return ""
+	}
+
+	return f.Regexp.String()
+}
+
+func (f *FlagRegexp) Set(value string) (error) {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return errors.Wrapf(err, "Error compiling regex %s", value)
+	}
+
+	f.Regexp = re
+
+	return nil
+}
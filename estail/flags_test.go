@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testQueries() (FlagQueries) {
+	queries := FlagQueries{}
+
+	for _, value := range []struct{
+		value string
+		filter bool
+	}{
+		{"status:500", false,},
+		{"errors=http_5xx", true,},
+		{"level=error", false,},
+	} {
+		queries.Var(value.filter).Set(value.value)
+	}
+
+	return queries
+}
+
+func TestFlagQueriesSet(t *testing.T) {
+	expected := FlagQueries{
+		{LabeledValue: LabeledValue{Value: "status:500",},},
+		{LabeledValue: LabeledValue{Label: "errors", Value: "http_5xx",}, Filter: true,},
+		{LabeledValue: LabeledValue{Value: "level=error",},},
+	}
+
+	if queries := testQueries(); ! reflect.DeepEqual(queries, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, queries)
+	}
+}
+
+func TestFlagQueriesLabelQueries(t *testing.T) {
+	for _, test := range []struct{
+		labels []string
+		expected []string
+	}{
+		{nil, []string{"", "errors", "",},},
+		{[]string{"server",}, []string{"server", "errors", "",},},
+		{[]string{"server", "app",}, []string{"server", "errors", "app",},},
+	} {
+		queries := testQueries()
+
+		err := queries.LabelQueries(test.labels)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", test.labels, err.Error())
+			continue
+		}
+
+		labels := make([]string, len(queries))
+		for i, query := range queries {
+			labels[i] = query.Label
+		}
+
+		if ! reflect.DeepEqual(labels, test.expected) {
+			t.Errorf("%v: expected labels %v, got %v", test.labels, test.expected, labels)
+		}
+	}
+}
+
+func TestFlagQueriesLabelQueriesInvalid(t *testing.T) {
+	for _, labels := range [][]string{
+		{"a", "b", "c",},
+		{"a b",},
+		{"",},
+	} {
+		err := testQueries().LabelQueries(labels)
+		if err == nil {
+			t.Errorf("%v: expected an error", labels)
+		}
+	}
+}
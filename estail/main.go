@@ -2,167 +2,296 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"sync"
 	"io"
 	"os"
-	"context"
 	"log"
 	"gopkg.in/olivere/elastic.v5"
 	"time"
-	"text/template"
 	"github.com/tehmoon/errors"
 	"github.com/tehmoon/estools/esfilters/lib/esfilters"
+	"github.com/tehmoon/estools/lib/connection"
+	"github.com/tehmoon/estools/lib/format"
+	"github.com/tehmoon/estools/lib/templates"
 )
 
 func main() {
 	flags := parseFlags()
 
-	tmpl, err := template.New("root").Funcs(functionTemplates).Parse(flags.Template)
+	var renderer format.Renderer
+
+	tmpl, err := templates.New().Parse(flags.Template)
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Error parsing default template").Error())
 	}
 
-	client, err := elastic.NewClient(elastic.SetURL(flags.Server), elastic.SetSniff(false))
+	renderer = tmpl
+
+	conn, err := connection.Load(flags.Connection)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	httpClient, err := conn.HTTPClient()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	client, err := elastic.NewClient(
+		elastic.SetURL(conn.URL),
+		elastic.SetSniff(false),
+		elastic.SetHttpClient(httpClient),
+		elastic.SetGzip(conn.Gzip),
+	)
 	if err != nil {
-		log.Fatal(errors.Wrapf(err, "Err creating connection to server %s", flags.Server).Error())
+		log.Fatal(errors.Wrapf(err, "Err creating connection to server %s", conn.URL).Error())
 	}
 
-	if flags.ConfigFile != "" {
-		config, err := esfilters.ImportConfigFromFile(flags.ConfigFile)
+	var config *esfilters.Config
+
+	if len(flags.ConfigFiles) != 0 {
+		config, err = esfilters.ImportConfigFromFiles(flags.ConfigFiles...)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
 
-		if flags.FilterName != "" {
-			flags.QueryStringQuery, err = config.Filters.Resolve(fmt.Sprintf(`%%{filter:%s}`, flags.FilterName))
-			if err != nil {
-				log.Fatal(errors.Wrapf(err, "Err resolving -filter-name option").Error())
-			}
-		} else {
-			flags.QueryStringQuery, err = config.Filters.Resolve(flags.QueryStringQuery)
+		for _, override := range config.Overrides {
+			log.Println(override.String())
+		}
+
+		if flags.Extract != "" {
+			renderer, err = NewExtractRenderer(config.JSONFilters, flags.Extract)
 			if err != nil {
-				log.Fatal(errors.Wrapf(err, "Err resolving -query option").Error())
+				log.Fatal(errors.Wrapf(err, "Err resolving -extract option").Error())
 			}
 		}
 	}
 
-	qs := elastic.NewQueryStringQuery(flags.QueryStringQuery)
-
-	lastTimestamp, err := getLastTimestamp(client, flags.Index, qs)
+	sources, err := NewSources(flags, config)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	for {
-		rq := elastic.NewRangeQuery("@timestamp").Gt(lastTimestamp)
-		bq := elastic.NewBoolQuery().Must(qs, rq)
-
-		res, err := client.Scroll(flags.Index).
-			Query(bq).
-			Sort("@timestamp", true).
-			Scroll("5s").
-			Size(500).
-			Do(context.Background())
+	if flags.Stats != 0 {
+		err = runStats(client, flags, sources)
 		if err != nil {
-			if err == io.EOF {
-				time.Sleep(5 * time.Second)
-				continue
-			}
+			log.Fatal(err.Error())
+		}
+
+		return
+	}
+
+	var stdout io.Writer = os.Stdout
+
+	highlight := flags.Highlight.Regexp
+	if highlight != nil && ! isTerminal(os.Stdout) {
+		highlight = nil
+	}
+
+	// With -grep-field the documents are grepped before being rendered
+	grep, grepV := flags.Grep.Regexp, flags.GrepV.Regexp
+	if flags.GrepField != "" {
+		grep, grepV = nil, nil
+	}
 
-			log.Fatalf(errors.Wrap(err, "Err querying elasticsearch").Error())
+	if highlight != nil || grep != nil || grepV != nil {
+		skip := 0
+		if format.HasHeader(flags.Format) {
+			skip = 1
 		}
 
-		scrollId := res.ScrollId
-		for _, hit := range res.Hits.Hits {
-			jresp := make(map[string]interface{})
+		stdout = NewLineFilter(os.Stdout, grep, grepV, highlight, skip)
+	}
 
-			err := json.Unmarshal(*hit.Source, &jresp)
-			if err != nil {
-				continue
-			}
+	var output format.Writer = format.NewRendererWriter(stdout, renderer)
+
+	if flags.Format != "" {
+		output, err = format.New(stdout, flags.Format, flags.Fields)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	var (
+		checkpointer *Checkpointer
+		checkpoints = make(Checkpoints)
+		// Held while a batch is written so a signal never saves
+		// the position of documents that are not written yet
+		batch = &sync.Mutex{}
+	)
+
+	if flags.Checkpoint != "" {
+		checkpoints, err = ReadCheckpoints(flags.Checkpoint)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
 
-			if timestamp, found := jresp["@timestamp"]; found {
-				if timestamp, ok := timestamp.(string); ok {
-					lastTimestamp = timestamp
+		checkpointer = NewCheckpointer(flags.Checkpoint, flags.CheckpointInterval, checkpoints)
+		saveCheckpointOnSignal(checkpointer, batch, output.Flush)
+	}
+
+	saveCheckpoint := func(force bool) {
+		err := checkpointer.Save(force)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Error saving checkpoint").Error())
+		}
+	}
+
+	lookback := int64(flags.Lookback / time.Millisecond)
+
+	for _, source := range sources {
+		position, found := checkpoints[source.Label]
+		if ! found && len(sources) == 1 {
+			position, found = checkpoints[legacyCheckpointLabel]
+		}
+
+		switch {
+			case found:
+				log.Printf("Resuming %s from %s at %s\n", source.Label, flags.Checkpoint, position.Time().Format(time.RFC3339Nano))
+
+				if flags.Start != "" {
+					log.Println("-start is ignored when resuming from a checkpoint")
 				}
-			}
 
-			err = tmpl.Execute(os.Stdout, jresp)
-			if err != nil {
-				log.Fatalf(errors.Wrap(err, "Error executing template").Error())
-			}
+				source.position = &position
+			case flags.Start != "":
+				source.from = flags.Start
+
+				continue
+			default:
+				source.position, err = getLastCheckpoint(client, flags, source)
+				if err != nil {
+					log.Fatal(err.Error())
+				}
+
+				if source.position == nil {
+					log.Printf("No documents found for %s yet\n", source.Label)
+					source.from = time.Now().UnixNano() / int64(time.Millisecond) - lookback
+
+					continue
+				}
 		}
 
-		for {
-			res, err := client.Scroll(flags.Index).
-				Query(bq).
-				Scroll("15s").
-				Sort("@timestamp", true).
-				ScrollId(scrollId).
-				Do(context.Background())
-			if err != nil {
-				if err == io.EOF {
-					break
+		// Documents of the window up to the position have already been
+		// emitted, the later ones are emitted even if they are older.
+		err = searchAfter(client, flags, source, timestampRange(flags.TimestampField, source.position.Timestamp - lookback, source.position.Timestamp), func(hits []*elastic.SearchHit) (error) {
+			for _, hit := range hits {
+				checkpoint, err := NewCheckpointFromHit(hit, flags.TimestampField)
+				if err != nil {
+					return err
 				}
 
-				log.Fatalf(errors.Wrap(err, "Err querying elasticsearch").Error())
+				if ! source.position.Before(*checkpoint) {
+					source.seen[hitKey(hit)] = checkpoint.Timestamp
+				}
 			}
 
-			for _, hit := range res.Hits.Hits {
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		source.from = source.position.Timestamp - lookback
+	}
+
+	var to interface{}
+
+	if flags.End != "" {
+		to = flags.End
+	}
+
+	for {
+		emitted := 0
+
+		err := searchSources(client, flags, sources, to, func(documents []*Document) (error) {
+			batch.Lock()
+			defer batch.Unlock()
+
+			moved := make(map[*Source]bool)
+
+			for _, document := range documents {
 				jresp := make(map[string]interface{})
-				json.Unmarshal(*hit.Source, &jresp)
 
-				if timestamp, found := jresp["@timestamp"]; found {
-					if timestamp, ok := timestamp.(string); ok {
-						lastTimestamp = timestamp
+				err := json.Unmarshal(*document.Hit.Source, &jresp)
+				if err != nil {
+					continue
+				}
+
+				emitted++
+
+				// Late documents do not move the position back
+				source := document.Source
+				if source.position == nil || source.position.Before(*document.Checkpoint) {
+					source.position = document.Checkpoint
+					moved[source] = true
+				}
+
+				jresp["_source_label"] = source.Label
+
+				if len(document.Hit.Highlight) != 0 {
+					fragments := make(map[string]interface{})
+
+					for field, values := range document.Hit.Highlight {
+						fragments[field] = values
+					}
+
+					jresp["_highlight"] = fragments
+				}
+
+				if flags.GrepField != "" {
+					value, _ := format.Lookup(jresp, flags.GrepField)
+					if ! grepValue(format.String(value), flags.Grep.Regexp, flags.GrepV.Regexp) {
+						continue
 					}
 				}
 
-				err = tmpl.Execute(os.Stdout, jresp)
+				err = output.Write(jresp)
 				if err != nil {
-					log.Fatalf(errors.Wrap(err, "Error executing template").Error())
+					return errors.Wrap(err, "Error writing document")
 				}
 			}
 
-			scrollId = res.ScrollId
-		}
+			err := output.Flush()
+			if err != nil {
+				return errors.Wrap(err, "Error writing documents")
+			}
 
-		_, err = client.ClearScroll(scrollId).
-			Do(context.Background())
-		if err != nil {
-			log.Fatalf(errors.Wrapf(err, "Failed to clear the scrollid %s", scrollId).Error())
-		}
-	}
-}
+			// The positions are saved once their documents are written
+			for source := range moved {
+				checkpointer.Update(source.Label, *source.position)
+			}
 
-func getLastTimestamp(client *elastic.Client, index string, qs *elastic.QueryStringQuery) (string, error) {
-	for {
-		res, err := client.Search(index).
-			Query(qs).
-			Size(1).
-			Sort("@timestamp", false).
-			Do(context.Background())
+			for _, source := range sources {
+				if source.position != nil {
+					source.seen.prune(source.position.Timestamp - lookback)
+				}
+			}
+
+			saveCheckpoint(false)
+
+			return nil
+		})
 		if err != nil {
-			return "", errors.Wrap(err, "Err querying elasticserach cluster")
+			log.Fatal(err.Error())
 		}
 
-		jresp := make(map[string]interface{})
+		// Caught up, the next documents may take a while
+		saveCheckpoint(true)
 
-		if len(res.Hits.Hits) != 0 {
-			json.Unmarshal(*res.Hits.Hits[0].Source, &jresp)
-			if timestamp, found := jresp["@timestamp"]; found {
-				if timestamp, ok := timestamp.(string); ok {
-					return timestamp, nil
-				}
-			}
+		if ! flags.Tail {
+			return
+		}
 
-			break
+		// The sources without documents keep searching from where they started
+		for _, source := range sources {
+			if source.position != nil {
+				source.from = source.position.Timestamp - lookback
+			}
 		}
 
-		log.Println("No results found... Sleeping")
-		time.Sleep(5 * time.Second)
-		continue
+		if emitted == 0 {
+			time.Sleep(5 * time.Second)
+		}
 	}
-
-	return "", errors.New("Unknown error")
 }
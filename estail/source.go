@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/tehmoon/errors"
+	"gopkg.in/olivere/elastic.v5"
+	"github.com/tehmoon/estools/esfilters/lib/esfilters"
+	"strings"
+)
+
+// Index and query tailed with the others, its documents get
+// the label in _source_label.
+type Source struct {
+	Label string
+	Index string
+	Query elastic.Query
+	// Last emitted document, nil until the first one
+	position *Checkpoint
+	seen seenDocuments
+	// Lower bound of the next search
+	from interface{}
+}
+
+type sourceQuery struct {
+	QueryFlag
+	query elastic.Query
+	// Default index of the filter
+	index string
+}
+
+// Sources of the -index paired with the -query or -filter-name by position.
+// A single -index is used by every query and a single query by every
+// -index. Labels default to the index or the query when there are more
+// than one of them.
+func NewSources(flags *Flags, config *esfilters.Config) ([]*Source, error) {
+	queries := make([]sourceQuery, len(flags.Queries))
+
+	for i, q := range flags.Queries {
+		queries[i].QueryFlag = q
+
+		if q.Filter {
+			query, err := config.Filters.Compile([]string{q.Value}, flags.Placeholders)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Err resolving -filter-name option %s", q.Value)
+			}
+
+			filter, _ := config.Filters.Filter(q.Value)
+			queries[i].query = query
+			queries[i].index = filter.Index
+
+			continue
+		}
+
+		qs := q.Value
+
+		if config != nil {
+			var err error
+
+			qs, err = config.Filters.ResolvePlaceholders(qs, flags.Placeholders)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Err resolving -query option %s", q.Value)
+			}
+		}
+
+		queries[i].query = elastic.NewQueryStringQuery(qs)
+	}
+
+	indexes := flags.Indexes
+
+	if len(indexes) > 1 && len(queries) > 1 && len(indexes) != len(queries) {
+		return nil, errors.Errorf("-index is set %d times and the queries %d times, they are paired by position", len(indexes), len(queries))
+	}
+
+	n := len(queries)
+	if len(indexes) > n {
+		n = len(indexes)
+	}
+
+	sources := make([]*Source, 0, n)
+
+	for i := 0; i < n; i++ {
+		query := queries[0]
+		if len(queries) > 1 {
+			query = queries[i]
+		}
+
+		var index LabeledValue
+
+		switch {
+			case len(indexes) > 1:
+				index = indexes[i]
+			case len(indexes) == 1:
+				index = indexes[0]
+			// The filters are tailed on their own index, then on the profile's one
+			default:
+				index.Value = query.index
+				if index.Value == "" {
+					index.Value = flags.DefaultIndex
+				}
+
+				if index.Value == "" {
+					return nil, errors.Errorf("Filter %s has no default index, -index is required", query.Value)
+				}
+		}
+
+		labels := make([]string, 0, 2)
+
+		if index.Label != "" || len(indexes) > 1 {
+			labels = append(labels, labelOrValue(index))
+		}
+
+		if query.Label != "" || len(queries) > 1 {
+			labels = append(labels, labelOrValue(query.LabeledValue))
+		}
+
+		if len(labels) == 0 {
+			labels = append(labels, index.Value)
+		}
+
+		sources = append(sources, &Source{
+			Label: strings.Join(labels, "/"),
+			Index: index.Value,
+			Query: query.query,
+			seen: make(seenDocuments),
+		})
+	}
+
+	labels := make(map[string]bool)
+
+	for _, source := range sources {
+		if labels[source.Label] {
+			return nil, errors.Errorf("Label %s is used by more than one source, set the labels with label=value or -query-label", source.Label)
+		}
+
+		labels[source.Label] = true
+	}
+
+	return sources, nil
+}
+
+func labelOrValue(v LabeledValue) (string) {
+	if v.Label != "" {
+		return v.Label
+	}
+
+	return v.Value
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewSourcesQueryLabels(t *testing.T) {
+	flags := &Flags{
+		Queries: FlagQueries{
+			{LabeledValue: LabeledValue{Label: "server", Value: "status:500",},},
+			{LabeledValue: LabeledValue{Value: "level:error",},},
+		},
+		Indexes: FlagLabeledValues{
+			{Label: "nginx", Value: "logs-nginx-*",},
+			{Value: "logs-app-*",},
+		},
+	}
+
+	sources, err := NewSources(flags, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := make([]string, len(sources))
+	for i, source := range sources {
+		labels[i] = source.Label
+	}
+
+	expected := []string{"nginx/server", "logs-app-*/level:error",}
+	if ! reflect.DeepEqual(labels, expected) {
+		t.Errorf("Expected labels %v, got %v", expected, labels)
+	}
+}
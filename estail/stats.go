@@ -0,0 +1,196 @@
+package main
+
+import (
+	"github.com/tehmoon/errors"
+	"github.com/tehmoon/estools/lib/format"
+	"gopkg.in/olivere/elastic.v5"
+	"text/tabwriter"
+	"encoding/json"
+	"context"
+	"strings"
+	"bytes"
+	"sync"
+	"time"
+	"fmt"
+	"io"
+	"os"
+)
+
+const statsTopAggregation = "top"
+
+// ANSI codes moving to the top left corner and clearing the terminal
+const clearTerminal = "\x1b[H\x1b[2J"
+
+type StatsValue struct {
+	Value string `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// Documents of a source matching the query within a window
+type Stats struct {
+	From time.Time `json:"from"`
+	To time.Time `json:"to"`
+	Label string `json:"label"`
+	Count int64 `json:"count"`
+	Rate float64 `json:"rate"`
+	Field string `json:"field,omitempty"`
+	Top []StatsValue `json:"top,omitempty"`
+}
+
+// Count the documents of the source from from to to excluded,
+// with the top values of -stats-field when set.
+func getStats(client *elastic.Client, flags *Flags, source *Source, from, to time.Time) (*Stats, error) {
+	rq := elastic.NewRangeQuery(flags.TimestampField).
+		Gte(from.UnixNano() / int64(time.Millisecond)).
+		Lt(to.UnixNano() / int64(time.Millisecond)).
+		Format("epoch_millis")
+
+	service := client.Search(source.Index).
+		Query(elastic.NewBoolQuery().Must(source.Query, rq)).
+		Size(0)
+
+	if flags.StatsField != "" {
+		service = service.Aggregation(statsTopAggregation, elastic.NewTermsAggregation().
+			Field(flags.StatsField).
+			Size(flags.StatsTop))
+	}
+
+	res, err := service.Do(context.Background())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Err querying elasticsearch for source %s", source.Label)
+	}
+
+	stats := &Stats{
+		From: from,
+		To: to,
+		Label: source.Label,
+		Field: flags.StatsField,
+	}
+
+	if res.Hits != nil {
+		stats.Count = res.Hits.TotalHits
+	}
+
+	stats.Rate = float64(stats.Count) / to.Sub(from).Seconds()
+
+	if terms, found := res.Aggregations.Terms(statsTopAggregation); found {
+		for _, bucket := range terms.Buckets {
+			value := format.String(bucket.Key)
+			if bucket.KeyAsString != nil {
+				value = *bucket.KeyAsString
+			}
+
+			stats.Top = append(stats.Top, StatsValue{
+				Value: value,
+				Count: bucket.DocCount,
+			})
+		}
+	}
+
+	return stats, nil
+}
+
+// Print the stats of every source for each interval. A window is counted
+// -lookback after it ends so the late documents are in it.
+func runStats(client *elastic.Client, flags *Flags, sources []*Source) (error) {
+	interval := flags.Stats
+	terminal := isTerminal(os.Stdout)
+	from := time.Now().Add(-flags.Lookback).Truncate(interval)
+
+	for {
+		to := from.Add(interval)
+
+		time.Sleep(to.Add(flags.Lookback).Sub(time.Now()))
+
+		wg := &sync.WaitGroup{}
+		stats := make([]*Stats, len(sources))
+		errs := make([]error, len(sources))
+
+		for i, source := range sources {
+			wg.Add(1)
+
+			go func(i int, source *Source) {
+				defer wg.Done()
+
+				stats[i], errs[i] = getStats(client, flags, source, from, to)
+			}(i, source)
+		}
+
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+
+		if terminal {
+			err = writeStatsTable(os.Stdout, stats)
+		} else {
+			err = writeStatsNDJSON(os.Stdout, stats)
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "Error writing stats")
+		}
+
+		from = to
+	}
+}
+
+// Redraw the table of the last window
+func writeStatsTable(w io.Writer, stats []*Stats) (error) {
+	buff := &bytes.Buffer{}
+	buff.WriteString(clearTerminal)
+
+	fmt.Fprintf(buff, "%s - %s\n\n", stats[0].From.Format("15:04:05"), stats[0].To.Format("15:04:05"))
+
+	tw := tabwriter.NewWriter(buff, 0, 1, 1, ' ', 0)
+
+	if stats[0].Field != "" {
+		fmt.Fprintf(tw, "Label\tCount\tRate/s\tTop %s\n", stats[0].Field)
+	} else {
+		fmt.Fprintln(tw, "Label\tCount\tRate/s")
+	}
+
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f", s.Label, s.Count, s.Rate)
+
+		if s.Field != "" {
+			top := make([]string, len(s.Top))
+
+			for i, value := range s.Top {
+				top[i] = fmt.Sprintf("%s (%d)", value.Value, value.Count)
+			}
+
+			fmt.Fprintf(tw, "\t%s", strings.Join(top, ", "))
+		}
+
+		fmt.Fprintln(tw)
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, buff.String())
+
+	return err
+}
+
+// One line per source and window
+func writeStatsNDJSON(w io.Writer, stats []*Stats) (error) {
+	encoder := json.NewEncoder(w)
+
+	for _, s := range stats {
+		err := encoder.Encode(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"github.com/tehmoon/errors"
+	"gopkg.in/olivere/elastic.v5"
+	"context"
+	"sort"
+	"sync"
+	"math"
+)
+
+const tailPageSize = 500
+
+// Documents of the lookback window already emitted, by
+// index/type/id with their timestamp in epoch milliseconds.
+type seenDocuments map[string]int64
+
+func hitKey(hit *elastic.SearchHit) (string) {
+	return hit.Index + "/" + hit.Type + "/" + hit.Id
+}
+
+// Remember the document, false if it has already been seen
+func (s seenDocuments) add(key string, timestamp int64) (bool) {
+	if _, found := s[key]; found {
+		return false
+	}
+
+	s[key] = timestamp
+
+	return true
+}
+
+// Forget the documents the next searches cannot return anymore
+func (s seenDocuments) prune(before int64) {
+	for key, timestamp := range s {
+		if timestamp < before {
+			delete(s, key)
+		}
+	}
+}
+
+// Range of timestamps in epoch milliseconds or Elasticsearch dates,
+// the bounds are left open when nil
+func timestampRange(field string, from, to interface{}) (*elastic.RangeQuery) {
+	rq := elastic.NewRangeQuery(field).Format("epoch_millis||strict_date_optional_time")
+
+	if from != nil {
+		rq = rq.Gte(from)
+	}
+
+	if to != nil {
+		rq = rq.Lte(to)
+	}
+
+	return rq
+}
+
+// Page of the documents of the source within rq sorted by timestamp then
+// tiebreaker, after the sort values of the last document of the previous
+// page. Pages are fetched with search_after so no scroll context is left
+// open between the polls.
+func searchPage(client *elastic.Client, flags *Flags, source *Source, rq *elastic.RangeQuery, after []interface{}) ([]*elastic.SearchHit, error) {
+	service := client.Search(source.Index).
+		Query(elastic.NewBoolQuery().Must(source.Query, rq)).
+		Sort(flags.TimestampField, true).
+		Sort(flags.Tiebreaker, true).
+		Size(tailPageSize)
+
+	if after != nil {
+		service = service.SearchAfter(after...)
+	}
+
+	if flags.ESHighlight {
+		service = service.Highlight(elastic.NewHighlight().
+			Fields(elastic.NewHighlighterField("*")).
+			RequireFieldMatch(false))
+	}
+
+	res, err := service.Do(context.Background())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Err querying elasticsearch for source %s", source.Label)
+	}
+
+	if res.Hits == nil {
+		return nil, nil
+	}
+
+	return res.Hits.Hits, nil
+}
+
+// Call fn with every page of documents of the source within rq
+func searchAfter(client *elastic.Client, flags *Flags, source *Source, rq *elastic.RangeQuery, fn func([]*elastic.SearchHit) (error)) (error) {
+	var after []interface{}
+
+	for {
+		hits, err := searchPage(client, flags, source, rq, after)
+		if err != nil {
+			return err
+		}
+
+		if len(hits) == 0 {
+			return nil
+		}
+
+		err = fn(hits)
+		if err != nil {
+			return err
+		}
+
+		if len(hits) < tailPageSize {
+			return nil
+		}
+
+		after = hits[len(hits) - 1].Sort
+	}
+}
+
+// Position of the newest document of the source, nil if there is none
+func getLastCheckpoint(client *elastic.Client, flags *Flags, source *Source) (*Checkpoint, error) {
+	res, err := client.Search(source.Index).
+		Query(source.Query).
+		Size(1).
+		Sort(flags.TimestampField, false).
+		Sort(flags.Tiebreaker, false).
+		Do(context.Background())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Err querying elasticserach cluster for source %s", source.Label)
+	}
+
+	if res.Hits == nil || len(res.Hits.Hits) == 0 {
+		return nil, nil
+	}
+
+	return NewCheckpointFromHit(res.Hits.Hits[0], flags.TimestampField)
+}
+
+// Document of a source not emitted yet
+type Document struct {
+	Source *Source
+	Hit *elastic.SearchHit
+	Checkpoint *Checkpoint
+}
+
+// Search of a source within a range, a page at a time
+type sourceScan struct {
+	source *Source
+	rq *elastic.RangeQuery
+	after []interface{}
+	// Last document of the last page
+	last *Checkpoint
+	done bool
+	pending []*Document
+}
+
+// Fetch the next page, the documents already seen are skipped
+func (s *sourceScan) fetch(client *elastic.Client, flags *Flags) (error) {
+	hits, err := searchPage(client, flags, s.source, s.rq, s.after)
+	if err != nil {
+		return err
+	}
+
+	if len(hits) < tailPageSize {
+		s.done = true
+	}
+
+	for _, hit := range hits {
+		checkpoint, err := NewCheckpointFromHit(hit, flags.TimestampField)
+		if err != nil {
+			return err
+		}
+
+		s.last = checkpoint
+
+		if ! s.source.seen.add(hitKey(hit), checkpoint.Timestamp) {
+			continue
+		}
+
+		s.pending = append(s.pending, &Document{
+			Source: s.source,
+			Hit: hit,
+			Checkpoint: checkpoint,
+		})
+	}
+
+	if len(hits) != 0 {
+		s.after = hits[len(hits) - 1].Sort
+	}
+
+	return nil
+}
+
+// Search the sources concurrently from their position up to to and call fn
+// with the new documents in timestamp order. Documents are held back only
+// until every source with more pages has gone past them, so at most a page
+// per source is kept in memory.
+func searchSources(client *elastic.Client, flags *Flags, sources []*Source, to interface{}, fn func([]*Document) (error)) (error) {
+	scans := make([]*sourceScan, len(sources))
+
+	for i, source := range sources {
+		scans[i] = &sourceScan{
+			source: source,
+			rq: timestampRange(flags.TimestampField, source.from, to),
+		}
+	}
+
+	var watermark int64 = math.MaxInt64
+
+	for {
+		wg := &sync.WaitGroup{}
+		errs := make([]error, len(scans))
+
+		// Only the sources holding the others back are fetched
+		for i, scan := range scans {
+			if scan.done || (scan.last != nil && scan.last.Timestamp > watermark) {
+				continue
+			}
+
+			wg.Add(1)
+
+			go func(i int, scan *sourceScan) {
+				defer wg.Done()
+
+				errs[i] = scan.fetch(client, flags)
+			}(i, scan)
+		}
+
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+
+		watermark = math.MaxInt64
+
+		for _, scan := range scans {
+			if ! scan.done && scan.last.Timestamp < watermark {
+				watermark = scan.last.Timestamp
+			}
+		}
+
+		documents := make([]*Document, 0)
+
+		for _, scan := range scans {
+			i := 0
+
+			for i < len(scan.pending) && (watermark == math.MaxInt64 || scan.pending[i].Checkpoint.Timestamp < watermark) {
+				i++
+			}
+
+			documents = append(documents, scan.pending[:i]...)
+			scan.pending = scan.pending[i:]
+		}
+
+		// Documents of a source are already sorted, the
+		// sources sharing a timestamp keep their order
+		sort.SliceStable(documents, func(i, j int) (bool) {
+			return documents[i].Checkpoint.Timestamp < documents[j].Checkpoint.Timestamp
+		})
+
+		if len(documents) != 0 {
+			err := fn(documents)
+			if err != nil {
+				return err
+			}
+		}
+
+		if watermark == math.MaxInt64 {
+			return nil
+		}
+	}
+}
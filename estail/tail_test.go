@@ -0,0 +1,58 @@
+package main
+
+import (
+	"gopkg.in/olivere/elastic.v5"
+	"testing"
+)
+
+func TestSeenDocumentsAdd(t *testing.T) {
+	seen := make(seenDocuments)
+
+	if ! seen.add("logs/doc/1", 1000) {
+		t.Fatal("First document reported as seen")
+	}
+
+	if seen.add("logs/doc/1", 1000) {
+		t.Fatal("Document seen twice is not reported as seen")
+	}
+
+	if ! seen.add("logs/doc/2", 1000) {
+		t.Fatal("Document sharing the timestamp reported as seen")
+	}
+}
+
+// Documents older than the lookback window are forgotten, the ones
+// a search of the window can still return are kept.
+func TestSeenDocumentsPrune(t *testing.T) {
+	seen := seenDocuments{
+		"old": 900,
+		"edge": 1000,
+		"new": 1500,
+	}
+
+	seen.prune(1000)
+
+	if _, found := seen["old"]; found {
+		t.Error("Document before the window not pruned")
+	}
+
+	for _, key := range []string{"edge", "new",} {
+		if _, found := seen[key]; ! found {
+			t.Errorf("Document %s within the window pruned", key)
+		}
+	}
+
+	// A pruned document is new again
+	if ! seen.add("old", 900) {
+		t.Error("Pruned document still reported as seen")
+	}
+}
+
+func TestHitKey(t *testing.T) {
+	a := hitKey(&elastic.SearchHit{Index: "logs-1", Type: "doc", Id: "1",})
+	b := hitKey(&elastic.SearchHit{Index: "logs-2", Type: "doc", Id: "1",})
+
+	if a == b {
+		t.Errorf("Documents of different indexes share the key %s", a)
+	}
+}
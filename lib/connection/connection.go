@@ -0,0 +1,218 @@
+package connection
+
+import (
+	"github.com/tehmoon/errors"
+	"time"
+)
+
+const DefaultURL = "http://localhost:9200"
+
+var ErrConnectionConfig = errors.New("Invalid connection settings")
+
+// Settings of the connection to an Elasticsearch cluster. They come from
+// a profile of ~/.estools, overridden by the environment then by the flags.
+type Config struct {
+	// Profile of ~/.estools, its default profile when empty
+	Profile string
+	URL string
+	Username string
+	Password string
+	// id:key or already base64 encoded
+	APIKey string
+	BearerToken string
+	ClientCert string
+	ClientKey string
+	CACert string
+	Insecure bool
+	Timeout time.Duration
+	Gzip bool
+	// Names of the flags given on the command line, see SetFlag
+	flags map[string]bool
+}
+
+// Implemented by *flag.FlagSet and *pflag.FlagSet
+type FlagSet interface {
+	StringVar(p *string, name string, value string, usage string)
+	BoolVar(p *bool, name string, value bool, usage string)
+	DurationVar(p *time.Duration, name string, value time.Duration, usage string)
+}
+
+// Register the flags of the connection. They default to nothing
+// so the environment and the profile are only overridden when set.
+func (c *Config) AddFlags(set FlagSet) {
+	set.StringVar(&c.URL, "server", "", "Specify elasticsearch server to query (default \"" + DefaultURL + "\")")
+	set.StringVar(&c.Username, "username", "", "Username of the basic authentication")
+	set.StringVar(&c.Password, "password", "", "Password of the basic authentication, prefer the ESTOOLS_PASSWORD environment variable")
+	set.StringVar(&c.APIKey, "api-key", "", "Elasticsearch API key as id:key or base64 encoded")
+	set.StringVar(&c.BearerToken, "bearer-token", "", "Bearer token sent in the Authorization header")
+	set.StringVar(&c.ClientCert, "client-cert", "", "PEM file of the TLS client certificate")
+	set.StringVar(&c.ClientKey, "client-key", "", "PEM file of the TLS client key")
+	set.StringVar(&c.CACert, "ca-cert", "", "PEM file of the certificate authorities of the server")
+	set.BoolVar(&c.Insecure, "insecure", false, "Do not verify the certificate of the server")
+	set.DurationVar(&c.Timeout, "timeout", 0, "Timeout of the requests, no timeout when 0")
+	set.BoolVar(&c.Gzip, "gzip", false, "Compress the requests")
+}
+
+// Register -profile, the named cluster of ~/.estools
+func (c *Config) AddProfileFlag(set FlagSet) {
+	set.StringVar(&c.Profile, "profile", "", "Named cluster of ~/.estools providing the defaults of the flags")
+}
+
+// Mark the flag as given on the command line, call it for every flag
+// visited after parsing. Only those flags override the environment and
+// the profile, or the non zero ones when SetFlag is never called.
+func (c *Config) SetFlag(name string) {
+	if c.flags == nil {
+		c.flags = make(map[string]bool)
+	}
+
+	c.flags[name] = true
+}
+
+// Settings of the profile, overridden by the environment then by the
+// flags. The credentials and TLS settings of the default profile are
+// only sent to its own server, unless the profile is named.
+func Load(flags Config) (*Config, error) {
+	profile, err := ReadProfile(flags.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	env, envSet, err := configFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	config := profile.Connection
+	config.merge(*env, envSet)
+	config.merge(flags, flags.setFlags())
+
+	if profile.Default && urlOrDefault(config.URL) != urlOrDefault(profile.Connection.URL) {
+		config = profile.Connection.withoutCredentials()
+		config.merge(*env, envSet)
+		config.merge(flags, flags.setFlags())
+	}
+
+	config.URL = urlOrDefault(config.URL)
+	config.flags = nil
+
+	err = config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func urlOrDefault(url string) (string) {
+	if url == "" {
+		return DefaultURL
+	}
+
+	return url
+}
+
+// Flags given on the command line, or the non zero ones
+func (c Config) setFlags() (map[string]bool) {
+	if c.flags != nil {
+		return c.flags
+	}
+
+	return map[string]bool{
+		"profile": c.Profile != "",
+		"server": c.URL != "",
+		"username": c.Username != "",
+		"password": c.Password != "",
+		"api-key": c.APIKey != "",
+		"bearer-token": c.BearerToken != "",
+		"client-cert": c.ClientCert != "",
+		"client-key": c.ClientKey != "",
+		"ca-cert": c.CACert != "",
+		"insecure": c.Insecure,
+		"timeout": c.Timeout != 0,
+		"gzip": c.Gzip,
+	}
+}
+
+// Settings without the authentication and the TLS ones
+func (c Config) withoutCredentials() (Config) {
+	return Config{
+		Profile: c.Profile,
+		URL: c.URL,
+		Timeout: c.Timeout,
+		Gzip: c.Gzip,
+	}
+}
+
+// Override the settings with the ones of o named in set. An authentication
+// method of o replaces the other methods of c.
+func (c *Config) merge(o Config, set map[string]bool) {
+	switch {
+		case set["username"] && o.Username != "":
+			c.APIKey, c.BearerToken = "", ""
+		case set["api-key"] && o.APIKey != "":
+			c.Username, c.Password, c.BearerToken = "", "", ""
+		case set["bearer-token"] && o.BearerToken != "":
+			c.Username, c.Password, c.APIKey = "", "", ""
+	}
+
+	for _, field := range []struct{
+		name string
+		dst *string
+		src string
+	}{
+		{"profile", &c.Profile, o.Profile,},
+		{"server", &c.URL, o.URL,},
+		{"username", &c.Username, o.Username,},
+		{"password", &c.Password, o.Password,},
+		{"api-key", &c.APIKey, o.APIKey,},
+		{"bearer-token", &c.BearerToken, o.BearerToken,},
+		{"client-cert", &c.ClientCert, o.ClientCert,},
+		{"client-key", &c.ClientKey, o.ClientKey,},
+		{"ca-cert", &c.CACert, o.CACert,},
+	} {
+		if set[field.name] {
+			*field.dst = field.src
+		}
+	}
+
+	if set["insecure"] {
+		c.Insecure = o.Insecure
+	}
+
+	if set["timeout"] {
+		c.Timeout = o.Timeout
+	}
+
+	if set["gzip"] {
+		c.Gzip = o.Gzip
+	}
+}
+
+func (c Config) validate() (error) {
+	methods := 0
+
+	for _, set := range []bool{c.Username != "", c.APIKey != "", c.BearerToken != "",} {
+		if set {
+			methods++
+		}
+	}
+
+	if methods > 1 {
+		return errors.Wrap(ErrConnectionConfig, "Only one of username, API key or bearer token can be used")
+	}
+
+	if c.Password != "" && c.Username == "" {
+		return errors.Wrap(ErrConnectionConfig, "A password requires a username")
+	}
+
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.Wrap(ErrConnectionConfig, "The client certificate and the client key go together")
+	}
+
+	if c.Timeout < 0 {
+		return errors.Wrap(ErrConnectionConfig, "The timeout cannot be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package connection
+
+import (
+	"github.com/tehmoon/errors"
+	"strconv"
+	"time"
+	"os"
+)
+
+// Environment variables of the settings
+const (
+	EnvProfile = "ESTOOLS_PROFILE"
+	EnvProfileFile = "ESTOOLS_PROFILE_FILE"
+	EnvURL = "ESTOOLS_SERVER"
+	EnvUsername = "ESTOOLS_USERNAME"
+	EnvPassword = "ESTOOLS_PASSWORD"
+	EnvAPIKey = "ESTOOLS_API_KEY"
+	EnvBearerToken = "ESTOOLS_BEARER_TOKEN"
+	EnvClientCert = "ESTOOLS_CLIENT_CERT"
+	EnvClientKey = "ESTOOLS_CLIENT_KEY"
+	EnvCACert = "ESTOOLS_CA_CERT"
+	EnvInsecure = "ESTOOLS_INSECURE"
+	EnvTimeout = "ESTOOLS_TIMEOUT"
+	EnvGzip = "ESTOOLS_GZIP"
+)
+
+// Settings of the environment with the names of the flags they set
+func configFromEnv() (*Config, map[string]bool, error) {
+	config := &Config{}
+	set := make(map[string]bool)
+
+	for _, field := range []struct{
+		env string
+		name string
+		dst *string
+	}{
+		{EnvURL, "server", &config.URL,},
+		{EnvUsername, "username", &config.Username,},
+		{EnvPassword, "password", &config.Password,},
+		{EnvAPIKey, "api-key", &config.APIKey,},
+		{EnvBearerToken, "bearer-token", &config.BearerToken,},
+		{EnvClientCert, "client-cert", &config.ClientCert,},
+		{EnvClientKey, "client-key", &config.ClientKey,},
+		{EnvCACert, "ca-cert", &config.CACert,},
+	} {
+		if value := os.Getenv(field.env); value != "" {
+			*field.dst = value
+			set[field.name] = true
+		}
+	}
+
+	for _, field := range []struct{
+		env string
+		name string
+		dst *bool
+	}{
+		{EnvInsecure, "insecure", &config.Insecure,},
+		{EnvGzip, "gzip", &config.Gzip,},
+	} {
+		value := os.Getenv(field.env)
+		if value == "" {
+			continue
+		}
+
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Error parsing environment variable %s", field.env)
+		}
+
+		*field.dst = b
+		set[field.name] = true
+	}
+
+	if value := os.Getenv(EnvTimeout); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Error parsing environment variable %s", EnvTimeout)
+		}
+
+		config.Timeout = timeout
+		set["timeout"] = true
+	}
+
+	return config, set, nil
+}
@@ -0,0 +1,147 @@
+package connection
+
+import (
+	"github.com/tehmoon/errors"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
+	"io/ioutil"
+	"time"
+	"os"
+)
+
+var ErrProfileNotFound = errors.New("Profile not found")
+
+// ~/.estools, in YAML or JSON:
+//
+//  default: prod
+//  clusters:
+//    prod:
+//      url: https://es.example.com:9200
+//      api_key: id:key
+//      ca_cert: /etc/ssl/es-ca.pem
+//      index: logs-*
+type profileFile struct {
+	Default string `yaml:"default"`
+	Clusters map[string]profileEntry `yaml:"clusters"`
+}
+
+type profileEntry struct {
+	URL string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	APIKey string `yaml:"api_key"`
+	BearerToken string `yaml:"bearer_token"`
+	ClientCert string `yaml:"client_cert"`
+	ClientKey string `yaml:"client_key"`
+	CACert string `yaml:"ca_cert"`
+	Insecure bool `yaml:"insecure"`
+	Timeout string `yaml:"timeout"`
+	Gzip bool `yaml:"gzip"`
+	Index string `yaml:"index"`
+	TimestampField string `yaml:"timestamp_field"`
+	Config string `yaml:"config"`
+}
+
+// Named cluster of the profile file
+type Profile struct {
+	Name string
+	// Picked as the default of the file rather than named
+	Default bool
+	Connection Config
+	// Index pattern queried without -index
+	Index string
+	TimestampField string
+	// esfilters config file, relative to the profile file
+	Config string
+}
+
+// Path of the profile file, ESTOOLS_PROFILE_FILE or ~/.estools
+func ProfileFile() (string, error) {
+	if p := os.Getenv(EnvProfileFile); p != "" {
+		return p, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "Error finding the home directory")
+	}
+
+	return filepath.Join(home, ".estools"), nil
+}
+
+// The named profile, ESTOOLS_PROFILE or the default one when name is empty.
+// An empty profile is returned when there is no file or no default profile.
+func ReadProfile(name string) (*Profile, error) {
+	if name == "" {
+		name = os.Getenv(EnvProfile)
+	}
+
+	p, err := ProfileFile()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) && name == "" {
+			return &Profile{}, nil
+		}
+
+		return nil, errors.Wrapf(err, "Error reading profile file %s", p)
+	}
+
+	file := &profileFile{}
+
+	err = yaml.Unmarshal(data, file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error unmarshaling profile file %s", p)
+	}
+
+	named := name != ""
+	if ! named {
+		name = file.Default
+	}
+
+	if name == "" {
+		return &Profile{}, nil
+	}
+
+	entry, found := file.Clusters[name]
+	if ! found {
+		return nil, errors.Wrapf(ErrProfileNotFound, "Profile %s is not in %s", name, p)
+	}
+
+	profile := &Profile{
+		Name: name,
+		Default: ! named,
+		Connection: Config{
+			Profile: name,
+			URL: entry.URL,
+			Username: entry.Username,
+			Password: entry.Password,
+			APIKey: entry.APIKey,
+			BearerToken: entry.BearerToken,
+			ClientCert: entry.ClientCert,
+			ClientKey: entry.ClientKey,
+			CACert: entry.CACert,
+			Insecure: entry.Insecure,
+			Gzip: entry.Gzip,
+		},
+		Index: entry.Index,
+		TimestampField: entry.TimestampField,
+		Config: entry.Config,
+	}
+
+	if entry.Timeout != "" {
+		profile.Connection.Timeout, err = time.ParseDuration(entry.Timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing the timeout of profile %s", name)
+		}
+	}
+
+	if profile.Config != "" && ! filepath.IsAbs(profile.Config) {
+		profile.Config = filepath.Join(filepath.Dir(p), profile.Config)
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,101 @@
+package connection
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/base64"
+	"crypto/x509"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP client of the settings, given to the elastic client with SetHttpClient
+func (c Config) HTTPClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+	}
+
+	if c.CACert != "" {
+		data, err := ioutil.ReadFile(c.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading the CA certificates")
+		}
+
+		pool := x509.NewCertPool()
+		if ! pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("No certificate found in %s", c.CACert)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error loading the client certificate")
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert,}
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout: 90 * time.Second,
+		MaxIdleConnsPerHost: 10,
+	}
+
+	if authorization := c.authorization(); authorization != "" {
+		transport = &authTransport{
+			transport: transport,
+			authorization: authorization,
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout: c.Timeout,
+	}, nil
+}
+
+// Value of the Authorization header, empty without credentials
+func (c Config) authorization() (string) {
+	switch {
+		case c.Username != "":
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		case c.APIKey != "":
+			key := c.APIKey
+			if strings.Contains(key, ":") {
+				key = base64.StdEncoding.EncodeToString([]byte(key))
+			}
+
+			return "ApiKey " + key
+		case c.BearerToken != "":
+			return "Bearer " + c.BearerToken
+	}
+
+	return ""
+}
+
+// Sets the Authorization header of every request
+type authTransport struct {
+	transport http.RoundTripper
+	authorization string
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request
+	clone := req.WithContext(req.Context())
+	clone.Header = make(http.Header, len(req.Header) + 1)
+
+	for key, values := range req.Header {
+		clone.Header[key] = values
+	}
+
+	clone.Header.Set("Authorization", t.authorization)
+
+	return t.transport.RoundTrip(clone)
+}
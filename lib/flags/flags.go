@@ -0,0 +1,48 @@
+package flags
+
+import (
+	"github.com/tehmoon/errors"
+	"strings"
+	"fmt"
+)
+
+// Repeatable flag of name=value pairs for esfilters placeholders
+type Placeholders map[string]string
+
+func (f Placeholders) String() (string) {
+	pairs := make([]string, 0, len(f))
+
+	for name, value := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f *Placeholders) Set(value string) (error) {
+	split := strings.SplitN(value, "=", 2)
+	if len(split) != 2 {
+		return errors.Errorf("Placeholder %q must be in the form name=value", value)
+	}
+
+	if *f == nil {
+		*f = make(Placeholders)
+	}
+
+	(*f)[split[0]] = split[1]
+
+	return nil
+}
+
+// Repeatable flag of strings, like layered config files
+type Strings []string
+
+func (f Strings) String() (string) {
+	return strings.Join(f, ",")
+}
+
+func (f *Strings) Set(value string) (error) {
+	*f = append(*f, value)
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package format
+
+import (
+	"encoding/csv"
+	"strings"
+	"io"
+)
+
+// CSV with a header row, the columns are fixed by the first document
+type CSVWriter struct {
+	w *csv.Writer
+	fields []string
+	columns []string
+}
+
+func NewCSVWriter(w io.Writer, fields []string) (*CSVWriter) {
+	return &CSVWriter{
+		w: csv.NewWriter(w),
+		fields: fields,
+	}
+}
+
+func (w *CSVWriter) Write(doc map[string]interface{}) (error) {
+	if w.columns == nil {
+		w.columns = columns(w.fields, doc)
+
+		err := w.w.Write(w.columns)
+		if err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, len(w.columns))
+
+	for i, value := range values(doc, w.columns) {
+		record[i] = String(value)
+	}
+
+	return w.w.Write(record)
+}
+
+func (w *CSVWriter) Flush() (error) {
+	w.w.Flush()
+
+	return w.w.Error()
+}
+
+// Tabs, newlines and backslashes are escaped so every
+// line is a record and every tab a separator.
+var tsvReplacer = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// Tab separated values with a header row
+type TSVWriter struct {
+	w io.Writer
+	fields []string
+	columns []string
+}
+
+func NewTSVWriter(w io.Writer, fields []string) (*TSVWriter) {
+	return &TSVWriter{
+		w: w,
+		fields: fields,
+	}
+}
+
+func (w *TSVWriter) Write(doc map[string]interface{}) (error) {
+	if w.columns == nil {
+		w.columns = columns(w.fields, doc)
+
+		err := w.writeLine(w.columns)
+		if err != nil {
+			return err
+		}
+	}
+
+	line := make([]string, len(w.columns))
+
+	for i, value := range values(doc, w.columns) {
+		line[i] = String(value)
+	}
+
+	return w.writeLine(line)
+}
+
+func (w TSVWriter) writeLine(line []string) (error) {
+	escaped := make([]string, len(line))
+
+	for i := range line {
+		escaped[i] = tsvReplacer.Replace(line[i])
+	}
+
+	_, err := io.WriteString(w.w, strings.Join(escaped, "\t") + "\n")
+
+	return err
+}
+
+func (w *TSVWriter) Flush() (error) {
+	return nil
+}
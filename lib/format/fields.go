@@ -0,0 +1,58 @@
+package format
+
+import (
+	"strings"
+	"sort"
+)
+
+// Value of field in the document. Dots go down nested objects,
+// keys containing dots like "log.level" are matched as well.
+func Lookup(doc map[string]interface{}, field string) (interface{}, bool) {
+	if value, found := doc[field]; found {
+		return value, true
+	}
+
+	for i := strings.Index(field, "."); i != -1; i = nextDot(field, i) {
+		sub, ok := doc[field[:i]].(map[string]interface{})
+		if ! ok {
+			continue
+		}
+
+		if value, found := Lookup(sub, field[i + 1:]); found {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+func nextDot(field string, i int) (int) {
+	j := strings.Index(field[i + 1:], ".")
+	if j == -1 {
+		return -1
+	}
+
+	return i + 1 + j
+}
+
+// Sorted dotted paths of the values of the document,
+// arrays are values and are not walked.
+func Fields(doc map[string]interface{}) ([]string) {
+	fields := make([]string, 0)
+
+	for key, value := range doc {
+		sub, ok := value.(map[string]interface{})
+		if ! ok || len(sub) == 0 {
+			fields = append(fields, key)
+			continue
+		}
+
+		for _, field := range Fields(sub) {
+			fields = append(fields, key + "." + field)
+		}
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
@@ -0,0 +1,126 @@
+package format
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"io"
+)
+
+// Output formats of the documents, the Go template stays
+// the default when none is set.
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV = "csv"
+	FormatTSV = "tsv"
+	FormatLogfmt = "logfmt"
+	FormatTable = "table"
+)
+
+var (
+	ErrFormatUnknown = errors.New("Unknown format")
+	Formats = []string{FormatNDJSON, FormatCSV, FormatTSV, FormatLogfmt, FormatTable,}
+)
+
+// Writes documents to the output. Flush is called after each batch
+// of documents so the buffered formats show up while tailing.
+type Writer interface {
+	Write(doc map[string]interface{}) (error)
+	Flush() (error)
+}
+
+// Writer of the format. Fields are dotted paths selecting the values,
+// when empty the columns are the fields of the first document.
+func New(w io.Writer, format string, fields []string) (Writer, error) {
+	switch format {
+		case FormatNDJSON:
+			return NewNDJSONWriter(w, fields), nil
+		case FormatCSV:
+			return NewCSVWriter(w, fields), nil
+		case FormatTSV:
+			return NewTSVWriter(w, fields), nil
+		case FormatLogfmt:
+			return NewLogfmtWriter(w, fields), nil
+		case FormatTable:
+			return NewTableWriter(w, fields), nil
+	}
+
+	return nil, errors.Wrapf(ErrFormatUnknown, "Format %s is not one of %s", format, strings.Join(Formats, ", "))
+}
+
+func IsFormat(format string) (bool) {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Formats starting with a header row
+func HasHeader(format string) (bool) {
+	switch format {
+		case FormatCSV, FormatTSV, FormatTable:
+			return true
+	}
+
+	return false
+}
+
+// Split a comma separated list of fields like "a,b,c.d"
+func ParseFields(s string) ([]string) {
+	fields := make([]string, 0)
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// Text of a value in a cell, objects and arrays are written in JSON
+func String(v interface{}) (string) {
+	switch v := v.(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(payload[:])
+}
+
+// Values of the columns in the document, missing ones are nil
+func values(doc map[string]interface{}, columns []string) ([]interface{}) {
+	values := make([]interface{}, len(columns))
+
+	for i, column := range columns {
+		values[i], _ = Lookup(doc, column)
+	}
+
+	return values
+}
+
+// Fields if any, otherwise the fields of doc so every
+// line has the columns of the first one.
+func columns(fields []string, doc map[string]interface{}) ([]string) {
+	if len(fields) != 0 {
+		return fields
+	}
+
+	return Fields(doc)
+}
@@ -0,0 +1,62 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"bytes"
+	"io"
+)
+
+// key=value pairs, all the fields of each document when none are set
+type LogfmtWriter struct {
+	w io.Writer
+	fields []string
+}
+
+func NewLogfmtWriter(w io.Writer, fields []string) (*LogfmtWriter) {
+	return &LogfmtWriter{
+		w: w,
+		fields: fields,
+	}
+}
+
+func (w LogfmtWriter) Write(doc map[string]interface{}) (error) {
+	buff := &bytes.Buffer{}
+	columns := columns(w.fields, doc)
+
+	for i, value := range values(doc, columns) {
+		if i != 0 {
+			buff.WriteByte(' ')
+		}
+
+		buff.WriteString(columns[i])
+		buff.WriteByte('=')
+		buff.WriteString(logfmtValue(String(value)))
+	}
+
+	buff.WriteByte('\n')
+
+	_, err := w.w.Write(buff.Bytes())
+
+	return err
+}
+
+func (w LogfmtWriter) Flush() (error) {
+	return nil
+}
+
+// Quote values that would not be read back as a single value
+func logfmtValue(value string) (string) {
+	if value == "" {
+		return `""`
+	}
+
+	if strings.IndexFunc(value, func(c rune) (bool) {
+		return c == '=' || c == '"' || unicode.IsSpace(c) || ! unicode.IsPrint(c)
+	}) != -1 {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
@@ -0,0 +1,76 @@
+package format
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"bytes"
+	"io"
+)
+
+// One JSON object per line, only with the fields when set
+type NDJSONWriter struct {
+	w io.Writer
+	fields []string
+}
+
+func NewNDJSONWriter(w io.Writer, fields []string) (*NDJSONWriter) {
+	return &NDJSONWriter{
+		w: w,
+		fields: fields,
+	}
+}
+
+func (w NDJSONWriter) Write(doc map[string]interface{}) (error) {
+	var (
+		payload []byte
+		err error
+	)
+
+	if len(w.fields) == 0 {
+		payload, err = json.Marshal(doc)
+	} else {
+		payload, err = marshalFields(w.fields, values(doc, w.fields))
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "Error marshaling document to JSON")
+	}
+
+	_, err = w.w.Write(append(payload, '\n'))
+
+	return err
+}
+
+func (w NDJSONWriter) Flush() (error) {
+	return nil
+}
+
+// Object keeping the order of the fields
+func marshalFields(fields []string, values []interface{}) ([]byte, error) {
+	buff := &bytes.Buffer{}
+	buff.WriteByte('{')
+
+	for i, field := range fields {
+		if i != 0 {
+			buff.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return nil, err
+		}
+
+		buff.Write(key)
+		buff.WriteByte(':')
+		buff.Write(value)
+	}
+
+	buff.WriteByte('}')
+
+	return buff.Bytes(), nil
+}
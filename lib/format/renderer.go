@@ -0,0 +1,31 @@
+package format
+
+import (
+	"io"
+)
+
+// Implemented by *template.Template
+type Renderer interface {
+	Execute(io.Writer, interface{}) (error)
+}
+
+// Writer rendering each document with a Go template or any Renderer
+type RendererWriter struct {
+	w io.Writer
+	renderer Renderer
+}
+
+func NewRendererWriter(w io.Writer, renderer Renderer) (*RendererWriter) {
+	return &RendererWriter{
+		w: w,
+		renderer: renderer,
+	}
+}
+
+func (w RendererWriter) Write(doc map[string]interface{}) (error) {
+	return w.renderer.Execute(w.w, doc)
+}
+
+func (w RendererWriter) Flush() (error) {
+	return nil
+}
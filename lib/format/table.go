@@ -0,0 +1,57 @@
+package format
+
+import (
+	"text/tabwriter"
+	"strings"
+	"io"
+)
+
+// Aligned columns with a header. The rows are aligned
+// within each batch since they are written on Flush.
+type TableWriter struct {
+	w *tabwriter.Writer
+	fields []string
+	columns []string
+}
+
+func NewTableWriter(w io.Writer, fields []string) (*TableWriter) {
+	return &TableWriter{
+		w: tabwriter.NewWriter(w, 0, 1, 1, ' ', 0),
+		fields: fields,
+	}
+}
+
+func (w *TableWriter) Write(doc map[string]interface{}) (error) {
+	if w.columns == nil {
+		w.columns = columns(w.fields, doc)
+
+		err := w.writeRow(w.columns)
+		if err != nil {
+			return err
+		}
+	}
+
+	row := make([]string, len(w.columns))
+
+	for i, value := range values(doc, w.columns) {
+		row[i] = String(value)
+	}
+
+	return w.writeRow(row)
+}
+
+func (w TableWriter) writeRow(row []string) (error) {
+	cells := make([]string, len(row))
+
+	for i := range row {
+		cells[i] = tsvReplacer.Replace(row[i])
+	}
+
+	_, err := io.WriteString(w.w, strings.Join(cells, "\t") + "\n")
+
+	return err
+}
+
+func (w *TableWriter) Flush() (error) {
+	return w.w.Flush()
+}
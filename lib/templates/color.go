@@ -0,0 +1,41 @@
+package templates
+
+import (
+	"github.com/tehmoon/estools/lib/format"
+	"github.com/tehmoon/errors"
+	"sort"
+	"strings"
+)
+
+// ANSI escape codes of the color function
+var colors = map[string]string{
+	"black": "30",
+	"red": "31",
+	"green": "32",
+	"yellow": "33",
+	"blue": "34",
+	"magenta": "35",
+	"cyan": "36",
+	"white": "37",
+	"gray": "90",
+	"bold": "1",
+	"underline": "4",
+}
+
+// Wrap the value in the ANSI codes of the color, like "red" or "bold"
+func color(name string, v interface{}) (string, error) {
+	code, found := colors[name]
+	if ! found {
+		names := make([]string, 0, len(colors))
+
+		for name := range colors {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return "", errors.Errorf("Color %s is not one of %s", name, strings.Join(names, ", "))
+	}
+
+	return "\x1b[" + code + "m" + format.String(v) + "\x1b[0m", nil
+}
@@ -0,0 +1,128 @@
+package templates
+
+import (
+	"github.com/tehmoon/estools/lib/format"
+	"github.com/tehmoon/errors"
+	"strconv"
+	"strings"
+	"regexp"
+	"sync"
+	"math"
+)
+
+// Compiled once per pattern since templates run for every document
+var regexps = struct{
+	sync *sync.Mutex
+	cache map[string]*regexp.Regexp
+}{
+	sync: &sync.Mutex{},
+	cache: make(map[string]*regexp.Regexp),
+}
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	regexps.sync.Lock()
+	defer regexps.sync.Unlock()
+
+	if re, found := regexps.cache[pattern]; found {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error compiling regex %s", pattern)
+	}
+
+	regexps.cache[pattern] = re
+
+	return re, nil
+}
+
+func regexMatch(pattern string, v interface{}) (bool, error) {
+	re, err := compileRegexp(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(format.String(v)), nil
+}
+
+// First capture group of the first match, or the whole match
+// when the pattern has no group. Empty when nothing matches.
+func regexExtract(pattern string, v interface{}) (string, error) {
+	re, err := compileRegexp(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	match := re.FindStringSubmatch(format.String(v))
+
+	switch len(match) {
+		case 0:
+			return "", nil
+		case 1:
+			return match[0], nil
+	}
+
+	return match[1], nil
+}
+
+// At most n characters, the cut ones are replaced by "..."
+func truncate(n int, v interface{}) (string) {
+	runes := []rune(format.String(v))
+	if n < 0 || len(runes) <= n {
+		return string(runes)
+	}
+
+	if n <= 3 {
+		return string(runes[:n])
+	}
+
+	return string(runes[:n - 3]) + "..."
+}
+
+// Number with the decimals and thousands separated by commas
+// like 1,234,567.89. Values that are not numbers are left as is.
+func number(decimals int, v interface{}) (string) {
+	var f float64
+
+	switch v := v.(type) {
+		case float64:
+			f = v
+		case float32:
+			f = float64(v)
+		case int:
+			f = float64(v)
+		case int64:
+			f = float64(v)
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return v
+			}
+
+			f = parsed
+		default:
+			return format.String(v)
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		integer, fraction = s[:i], s[i:]
+	}
+
+	for i := len(integer) - 3; i > 0; i -= 3 {
+		integer = integer[:i] + "," + integer[i:]
+	}
+
+	if f < 0 {
+		integer = "-" + integer
+	}
+
+	return integer + fraction
+}
@@ -0,0 +1,132 @@
+package templates
+
+import (
+	"github.com/tehmoon/estools/esfilters/lib/esfilters"
+	"github.com/tehmoon/estools/lib/format"
+	"text/template"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Functions available in the templates of every tool. Arguments come
+// first so the value can be piped in: {{ .message | truncate 80 }}.
+// A new map is returned so callers can add their own functions.
+func Functions() (template.FuncMap) {
+	return template.FuncMap{
+		"json": jsonString,
+		"json_indent": jsonIndent,
+		"newline": func() (string) {
+			return "\n"
+		},
+		"get": get,
+		"default": defaultValue,
+		"time_parse": timeParse,
+		"time_format": timeFormat,
+		"time_ago": timeAgo,
+		"upper": func(v interface{}) (string) {
+			return strings.ToUpper(format.String(v))
+		},
+		"lower": func(v interface{}) (string) {
+			return strings.ToLower(format.String(v))
+		},
+		"trim": func(v interface{}) (string) {
+			return strings.TrimSpace(format.String(v))
+		},
+		"truncate": truncate,
+		"replace": func(old, new string, v interface{}) (string) {
+			return strings.Replace(format.String(v), old, new, -1)
+		},
+		"regex_match": regexMatch,
+		"regex_extract": regexExtract,
+		"join": join,
+		"number": number,
+		"color": color,
+		// Make values safe to use in a query string query
+		"qs_escape": esfilters.QueryStringEscape,
+		"qs_quote": esfilters.QueryStringQuote,
+	}
+}
+
+// New template named root with the functions
+func New() (*template.Template) {
+	return template.New("root").Funcs(Functions())
+}
+
+func jsonString(v interface{}) (string) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(payload[:])
+}
+
+func jsonIndent(v interface{}) (string) {
+	payload, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return ""
+	}
+
+	return string(payload[:])
+}
+
+// Value of the dotted path in v, nil when it is missing. Values
+// other than JSON objects, like structs, go through their JSON form.
+func get(path string, v interface{}) (interface{}) {
+	doc, ok := v.(map[string]interface{})
+	if ! ok {
+		payload, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+
+		err = json.Unmarshal(payload, &doc)
+		if err != nil {
+			return nil
+		}
+	}
+
+	value, _ := format.Lookup(doc, path)
+
+	return value
+}
+
+// v unless it is nil, empty or the zero value
+func defaultValue(def, v interface{}) (interface{}) {
+	if v == nil {
+		return def
+	}
+
+	value := reflect.ValueOf(v)
+
+	switch value.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			if value.Len() == 0 {
+				return def
+			}
+		case reflect.Ptr, reflect.Interface:
+			if value.IsNil() {
+				return def
+			}
+	}
+
+	return v
+}
+
+func join(sep string, v interface{}) (string) {
+	value := reflect.ValueOf(v)
+
+	switch value.Kind() {
+		case reflect.Slice, reflect.Array:
+			elems := make([]string, value.Len())
+
+			for i := range elems {
+				elems[i] = format.String(value.Index(i).Interface())
+			}
+
+			return strings.Join(elems, sep)
+	}
+
+	return format.String(v)
+}
@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"github.com/tehmoon/errors"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts tried in order when parsing a date string
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Parse a date: a time, a string in one of timeLayouts
+// or a number of milliseconds since epoch.
+func timeParse(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+		case time.Time:
+			return v, nil
+		case *time.Time:
+			if v != nil {
+				return *v, nil
+			}
+		case float64:
+			return epochMillis(int64(v)), nil
+		case int64:
+			return epochMillis(v), nil
+		case int:
+			return epochMillis(int64(v)), nil
+		case json.Number:
+			ms, err := v.Int64()
+			if err != nil {
+				return time.Time{}, errors.Wrapf(err, "Error parsing %s as milliseconds", v)
+			}
+
+			return epochMillis(ms), nil
+		case string:
+			for _, layout := range timeLayouts {
+				t, err := time.Parse(layout, v)
+				if err == nil {
+					return t, nil
+				}
+			}
+
+			return time.Time{}, errors.Errorf("Date %q is not in a known format", v)
+	}
+
+	return time.Time{}, errors.Errorf("Value of type %T is not a date", v)
+}
+
+func epochMillis(ms int64) (time.Time) {
+	return time.Unix(0, ms * int64(time.Millisecond)).UTC()
+}
+
+// Format the date with a Go layout or one of rfc3339, unix, unix_ms.
+// Missing values are empty so templates keep working on documents
+// without the field.
+func timeFormat(layout string, v interface{}) (string, error) {
+	if isEmpty(v) {
+		return "", nil
+	}
+
+	t, err := timeParse(v)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(layout) {
+		case "rfc3339":
+			return t.Format(time.RFC3339Nano), nil
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10), nil
+		case "unix_ms":
+			return strconv.FormatInt(t.UnixNano() / int64(time.Millisecond), 10), nil
+	}
+
+	return t.Format(layout), nil
+}
+
+// Age of the date rounded to the second like "3m12s ago" or "in 5s"
+func timeAgo(v interface{}) (string, error) {
+	if isEmpty(v) {
+		return "", nil
+	}
+
+	t, err := timeParse(v)
+	if err != nil {
+		return "", err
+	}
+
+	age := time.Since(t).Round(time.Second)
+	if age < 0 {
+		return "in " + (-age).String(), nil
+	}
+
+	return age.String() + " ago", nil
+}
+
+func isEmpty(v interface{}) (bool) {
+	return v == nil || v == ""
+}